@@ -2,29 +2,83 @@ package analysis
 
 import (
 	"fmt"
+	"path"
+	"reflect"
+	"strings"
 	"wisp/ast"
 )
 
 type Analyzer struct {
+	env    *Env
 	output Form
 }
 
+// Env is the state shared by the analysis of a whole program, such as the
+// macros defined so far.
+type Env struct {
+	macros    map[string]Macro
+	expanding int
+	gensyms   int
+	// loops is the number of loops around the expression being analyzed.
+	loops int
+	// errors are the malformed expressions met so far.
+	errors []error
+}
+
+func NewEnv() *Env {
+	return &Env{macros: map[string]Macro{}}
+}
+
+// gensym makes a name that can't clash with the symbols of a program, as
+// they can't contain parens.
+func (env *Env) gensym() string {
+	env.gensyms++
+	return fmt.Sprintf("(%d)", env.gensyms)
+}
+
 func Analyze(expr ast.Expr) Form {
-	analyzer := Analyzer{}
+	return NewEnv().Analyze(expr)
+}
+
+func AnalyzeProgram(exprs []ast.Expr) []Form {
+	return NewEnv().AnalyzeProgram(exprs)
+}
+
+func (env *Env) Analyze(expr ast.Expr) Form {
+	analyzer := Analyzer{env: env}
 	expr.Accept(&analyzer)
+
+	if e, ok := analyzer.output.(FormError); ok && e.Span == (ast.ByteSpan{}) {
+		// located at the innermost expression, as outer ones can return
+		// it as is
+		e.Span = ast.SpanOf(expr)
+		env.errors = append(env.errors, e)
+		return e
+	}
 	return analyzer.output
 }
 
-func AnalyzeProgram(exprs []ast.Expr) []Form {
+// Errors returns the malformed expressions of what was analyzed, which
+// analyze to a FormError failing when evaluated.
+func (env *Env) Errors() []error {
+	return env.errors
+}
+
+func (env *Env) AnalyzeProgram(exprs []ast.Expr) []Form {
 	analyzed := []Form{}
 	for _, expr := range exprs {
-		analyzed = append(analyzed, Analyze(expr))
+		analyzed = append(analyzed, env.Analyze(expr))
 	}
 	return analyzed
 }
 
 func (anal *Analyzer) VisitSymbol(symbol *ast.Symbol) {
-	anal.output = Symbol{Name: symbol.Name}
+	if strings.HasPrefix(symbol.Name, ":") {
+		// keywords evaluate to themselves
+		anal.output = Quote{Expr: symbol}
+		return
+	}
+	anal.output = Symbol{Name: symbol.Name, Span: symbol.Span}
 }
 
 func (anal *Analyzer) VisitNumber(number *ast.Number) {
@@ -48,42 +102,85 @@ func (anal *Analyzer) VisitList(list *ast.List) {
 
 	switch hd := head.(type) {
 	case *ast.Symbol:
-		if dispatch, found := formsTable[hd.Name]; found {
-			anal.output = dispatch(rest)
+		if macro, found := anal.env.macros[hd.Name]; found {
+			anal.output = anal.env.expand(macro, list.Span, rest)
+		} else if dispatch, found := formsTable[hd.Name]; found {
+			anal.output = dispatch(anal.env, rest)
 		} else {
-			anal.output = callForm(head, rest)
+			anal.output = callForm(anal.env, list.Span, head, rest)
 		}
 	default:
-		anal.output = callForm(head, rest)
+		anal.output = callForm(anal.env, list.Span, head, rest)
 	}
 }
 
+func (anal *Analyzer) VisitVector(vector *ast.Vector) {
+	elements := []Form{}
+
+	for _, element := range vector.Elements {
+		elements = append(elements, anal.env.Analyze(element))
+	}
+
+	anal.output = Vector{Elements: elements}
+}
+
 func (anal *Analyzer) VisitObject(object *ast.Object) {
 	entries := map[Form]Form{}
 
 	for key, value := range object.Entries {
-		entries[Analyze(key)] = Analyze(value)
+		keyForm := anal.env.Analyze(key)
+		if !reflect.ValueOf(keyForm).Comparable() {
+			// forms holding lists of forms, such as vectors and calls,
+			// can't be looked up
+			anal.output = FormError{Message: fmt.Sprintf("unsupported object key %s: keys can't contain lists, vectors or objects", ast.Format(key))}
+			return
+		}
+		entries[keyForm] = anal.env.Analyze(value)
 	}
 
-	anal.output = Object{Entries: entries}
+	anal.output = Object{Entries: entries, Span: object.Span}
 }
 
-type FuncAnalyzer func([]ast.Expr) Form
+type FuncAnalyzer func(*Env, []ast.Expr) Form
 
 var formsTable map[string]FuncAnalyzer = map[string]FuncAnalyzer{
-	"do":    doForm,
-	"def":   defForm,
-	"defun": defunForm,
-	"echo":  echoForm,
-	"fun":   funForm,
-	"if":    ifForm,
-	"let":   letForm,
+	"block":   blockForm,
+	"case":    caseForm,
+	"cond":    condForm,
+	"do":      doForm,
+	"def":     defForm,
+	"defun":   defunForm,
+	"echo":    echoForm,
+	"extends": extendsForm,
+	"for":     forForm,
+	"fun":     funForm,
+	"if":      ifForm,
+	"include": includeForm,
+	"let":     letForm,
+	"loop":    loopForm,
+	"match":   matchForm,
+	"recur":   recurForm,
+	"require": requireForm,
+	"set!":    setForm,
+	"try":     tryForm,
+	"unless":  unlessForm,
+	"when":    whenForm,
+
+	"defmacro":         defmacroForm,
+	"macroexpand":      macroexpandForm,
+	"quote":            quoteForm,
+	"quasiquote":       quasiquoteForm,
+	"unquote":          unquoteForm,
+	"unquote-splicing": unquoteForm,
+
+	"defmiddleware": defmiddlewareForm,
+	"sse":           sseForm,
 }
 
-func letForm(exprs []ast.Expr) Form {
+func letForm(env *Env, exprs []ast.Expr) Form {
 	exprsLen := len(exprs)
-	if exprsLen != 2 {
-		return FormError{Message: "Expected 2 expressions"}
+	if exprsLen < 2 {
+		return FormError{Message: "Expected binds and body"}
 	}
 
 	bindsSeq, err := assertList(exprs[0])
@@ -101,20 +198,17 @@ func letForm(exprs []ast.Expr) Form {
 			return FormError{Message: "Expected bind pair value"}
 		}
 
-		sym, err := assertSymbol(bindsSeq[symIdx])
+		value := env.Analyze(bindsSeq[valIdx])
+
+		binds, err := destructure(env, bindsSeq[symIdx], value)
 		if err != nil {
-			return FormError{Message: "Expected bind pair symbol"}
+			return FormError{Message: err.Error()}
 		}
 
-		value := Analyze(bindsSeq[valIdx])
-
-		letBinds = append(letBinds, BindPair{
-			Symbol: sym,
-			Value:  value,
-		})
+		letBinds = append(letBinds, binds...)
 	}
 
-	body := Analyze(exprs[1])
+	body := bodyForm(env, exprs[1:])
 
 	return Let{
 		Binds: letBinds,
@@ -122,10 +216,10 @@ func letForm(exprs []ast.Expr) Form {
 	}
 }
 
-func funForm(rest []ast.Expr) Form {
+func funForm(env *Env, rest []ast.Expr) Form {
 	restLen := len(rest)
-	if restLen != 2 {
-		return FormError{Message: "Expected 2 expressions"}
+	if restLen < 2 {
+		return FormError{Message: "Expected parameters and body"}
 	}
 
 	list, err := assertList(rest[0])
@@ -133,16 +227,12 @@ func funForm(rest []ast.Expr) Form {
 		return FormError{Message: "Expected list"}
 	}
 
-	parametersList := []string{}
-	for _, expr := range list {
-		param, err := assertSymbol(expr)
-		if err != nil {
-			return FormError{Message: "Expected symbol"}
-		}
-		parametersList = append(parametersList, param)
+	parametersList, binds, err := parameters(env, list)
+	if err != nil {
+		return FormError{Message: err.Error()}
 	}
 
-	body := Analyze(rest[1])
+	body := destructured(binds, bodyForm(env, rest[1:]))
 
 	return Fun{
 		Parameters: parametersList,
@@ -150,7 +240,21 @@ func funForm(rest []ast.Expr) Form {
 	}
 }
 
-func doForm(exprs []ast.Expr) Form {
+// bodyForm analyzes the body of a form, evaluated as a do when it has more
+// than one expression.
+func bodyForm(env *Env, exprs []ast.Expr) Form {
+	if len(exprs) == 1 {
+		return env.Analyze(exprs[0])
+	}
+
+	analyzed := []Form{}
+	for _, expr := range exprs {
+		analyzed = append(analyzed, env.Analyze(expr))
+	}
+	return Do{Forms: analyzed}
+}
+
+func doForm(env *Env, exprs []ast.Expr) Form {
 	exprsLen := len(exprs)
 	if exprsLen < 1 {
 		return FormError{Message: "Empty do form"}
@@ -159,13 +263,13 @@ func doForm(exprs []ast.Expr) Form {
 	analyzed := []Form{}
 
 	for _, expr := range exprs {
-		analyzed = append(analyzed, Analyze(expr))
+		analyzed = append(analyzed, env.Analyze(expr))
 	}
 
 	return Do{Forms: analyzed}
 }
 
-func defForm(rest []ast.Expr) Form {
+func defForm(env *Env, rest []ast.Expr) Form {
 	restLen := len(rest)
 	if restLen != 2 {
 		return FormError{Message: "Expected to have 2 more expressions"}
@@ -179,7 +283,7 @@ func defForm(rest []ast.Expr) Form {
 	}
 
 	body := rest[1]
-	analyzedBody := Analyze(body)
+	analyzedBody := env.Analyze(body)
 
 	return Def{
 		Name: name,
@@ -187,10 +291,34 @@ func defForm(rest []ast.Expr) Form {
 	}
 }
 
-func defunForm(rest []ast.Expr) Form {
+// defmiddlewareForm analyzes (defmiddleware name (req next) body...), a
+// function given the request and the rest of the chain, which it calls with
+// (next) unless it responds itself.
+func defmiddlewareForm(env *Env, rest []ast.Expr) Form {
+	if len(rest) < 3 {
+		return FormError{Message: "Expected name, parameters and body"}
+	}
+
+	list, err := assertList(rest[1])
+	if err != nil {
+		return FormError{Message: "Expected list"}
+	}
+	if len(list) != 2 {
+		return FormError{Message: "Expected (req next) parameters"}
+	}
+	for _, param := range list {
+		if sym, ok := param.(*ast.Symbol); ok && strings.HasPrefix(sym.Name, "&") {
+			return FormError{Message: "Expected (req next) parameters"}
+		}
+	}
+
+	return defunForm(env, rest)
+}
+
+func defunForm(env *Env, rest []ast.Expr) Form {
 	restLen := len(rest)
-	if restLen != 3 {
-		return FormError{Message: "Expected to have 2 more expressions"}
+	if restLen < 3 {
+		return FormError{Message: "Expected name, parameters and body"}
 	}
 
 	sym := rest[0]
@@ -205,17 +333,13 @@ func defunForm(rest []ast.Expr) Form {
 		return FormError{Message: "Expected list"}
 	}
 
-	parametersList := []string{}
-	for _, expr := range list {
-		param, err := assertSymbol(expr)
-		if err != nil {
-			return FormError{Message: "Expected symbol"}
-		}
-		parametersList = append(parametersList, param)
+	parametersList, binds, err := parameters(env, list)
+	if err != nil {
+		return FormError{Message: err.Error()}
 	}
 
-	body := rest[2]
-	analyzedBody := Analyze(body)
+	body := rest[2:]
+	analyzedBody := destructured(binds, bodyForm(env, body))
 
 	return Defun{
 		Name:       name,
@@ -224,6 +348,117 @@ func defunForm(rest []ast.Expr) Form {
 	}
 }
 
+// parameters analyzes a parameter list:
+//
+//	(a b &optional c (d default) & rest &key e (f default))
+//
+// Required parameters given as patterns are passed under generated names
+// and destructured by the returned binds.
+func parameters(env *Env, list []ast.Expr) (Parameters, []BindPair, error) {
+	params := Parameters{
+		Required:  []string{},
+		Optional:  []Parameter{},
+		Keywords:  []Parameter{},
+		Signature: ast.Format(&ast.List{Elements: list}),
+	}
+	binds := []BindPair{}
+
+	const (
+		required = iota
+		optional
+		rest
+		keywords
+	)
+	markers := map[string]int{
+		"&optional": optional,
+		"&":         rest,
+		"&key":      keywords,
+	}
+	section := required
+
+	for _, expr := range list {
+		if name, err := assertSymbol(expr); err == nil {
+			if next, isMarker := markers[name]; isMarker {
+				if next <= section {
+					return params, nil, fmt.Errorf("unexpected %s", name)
+				}
+				section = next
+				continue
+			}
+		}
+
+		switch section {
+		case required:
+			if param, err := assertSymbol(expr); err == nil {
+				params.Required = append(params.Required, param)
+				continue
+			}
+
+			param := env.gensym()
+			paramBinds, err := destructure(env, expr, Symbol{Name: param})
+			if err != nil {
+				return params, nil, err
+			}
+			params.Required = append(params.Required, param)
+			binds = append(binds, paramBinds...)
+
+		case optional, keywords:
+			param, err := parameter(env, expr)
+			if err != nil {
+				return params, nil, err
+			}
+			if section == optional {
+				params.Optional = append(params.Optional, param)
+			} else {
+				params.Keywords = append(params.Keywords, param)
+			}
+
+		case rest:
+			if params.Rest != "" {
+				return params, nil, fmt.Errorf("expected a single parameter after &")
+			}
+			name, err := assertSymbol(expr)
+			if err != nil {
+				return params, nil, fmt.Errorf("expected symbol after &")
+			}
+			params.Rest = name
+		}
+	}
+
+	if section == rest && params.Rest == "" {
+		return params, nil, fmt.Errorf("expected a parameter after &")
+	}
+
+	return params, binds, nil
+}
+
+// parameter analyzes an optional or keyword parameter, name or
+// (name default).
+func parameter(env *Env, expr ast.Expr) (Parameter, error) {
+	if name, err := assertSymbol(expr); err == nil {
+		return Parameter{Name: name}, nil
+	}
+
+	list, err := assertList(expr)
+	if err != nil || len(list) != 2 {
+		return Parameter{}, fmt.Errorf("expected name or (name default)")
+	}
+
+	name, err := assertSymbol(list[0])
+	if err != nil {
+		return Parameter{}, fmt.Errorf("expected symbol")
+	}
+
+	return Parameter{Name: name, Default: env.Analyze(list[1])}, nil
+}
+
+func destructured(binds []BindPair, body Form) Form {
+	if len(binds) == 0 {
+		return body
+	}
+	return Let{Binds: binds, Body: body}
+}
+
 func assertSymbol(expr ast.Expr) (string, error) {
 	switch v := expr.(type) {
 	case *ast.Symbol:
@@ -242,38 +477,51 @@ func assertList(expr ast.Expr) ([]ast.Expr, error) {
 	}
 }
 
-func callForm(head ast.Expr, tail []ast.Expr) Form {
-	analyzedHead := Analyze(head)
+func callForm(env *Env, span ast.ByteSpan, head ast.Expr, tail []ast.Expr) Form {
+	analyzedHead := env.Analyze(head)
 
 	analyzedTail := []Form{}
 	for _, expr := range tail {
-		analyzedTail = append(analyzedTail, Analyze(expr))
+		analyzedTail = append(analyzedTail, env.Analyze(expr))
 	}
 
 	return Call{
 		Callee:    analyzedHead,
 		Arguments: analyzedTail,
+		Span:      span,
 	}
 }
 
-func echoForm(exprs []ast.Expr) Form {
+func echoForm(env *Env, exprs []ast.Expr) Form {
 	forms := []Form{}
 	for _, expr := range exprs {
-		forms = append(forms, Analyze(expr))
+		forms = append(forms, env.Analyze(expr))
 	}
 
 	return Echo{Forms: forms}
 }
 
-func ifForm(exprs []ast.Expr) Form {
+func sseForm(env *Env, exprs []ast.Expr) Form {
+	if len(exprs) < 1 {
+		return FormError{Message: "Expected body"}
+	}
+
+	return SSE{Body: bodyForm(env, exprs)}
+}
+
+func ifForm(env *Env, exprs []ast.Expr) Form {
 	exprsLen := len(exprs)
-	if exprsLen != 3 {
-		return FormError{Message: "Expected three forms"}
+	if exprsLen != 2 && exprsLen != 3 {
+		return FormError{Message: "Expected condition, then and optional else"}
 	}
 
-	condition := Analyze(exprs[0])
-	then := Analyze(exprs[1])
-	else_ := Analyze(exprs[2])
+	condition := env.Analyze(exprs[0])
+	then := env.Analyze(exprs[1])
+
+	var else_ Form
+	if exprsLen == 3 {
+		else_ = env.Analyze(exprs[2])
+	}
 
 	return If{
 		Condition: condition,
@@ -281,3 +529,269 @@ func ifForm(exprs []ast.Expr) Form {
 		Else:      else_,
 	}
 }
+
+func includeForm(env *Env, exprs []ast.Expr) Form {
+	exprsLen := len(exprs)
+	if exprsLen != 1 && exprsLen != 2 {
+		return FormError{Message: "Expected a path and optional bindings"}
+	}
+
+	path := env.Analyze(exprs[0])
+
+	var bindings Form
+	if exprsLen == 2 {
+		bindings = env.Analyze(exprs[1])
+	}
+
+	return Include{
+		Path:     path,
+		Bindings: bindings,
+		Span:     ast.SpanOf(exprs[0]),
+	}
+}
+
+func extendsForm(env *Env, exprs []ast.Expr) Form {
+	if len(exprs) != 1 {
+		return FormError{Message: "Expected layout path"}
+	}
+
+	return Extends{Path: env.Analyze(exprs[0]), Span: ast.SpanOf(exprs[0])}
+}
+
+func blockForm(env *Env, exprs []ast.Expr) Form {
+	if len(exprs) < 1 {
+		return FormError{Message: "Expected block name"}
+	}
+
+	name, err := assertSymbol(exprs[0])
+	if err != nil {
+		return FormError{Message: "Expected symbol name"}
+	}
+
+	body := []Form{}
+	for _, expr := range exprs[1:] {
+		body = append(body, env.Analyze(expr))
+	}
+
+	return Block{
+		Name: name,
+		Body: body,
+	}
+}
+
+func requireForm(env *Env, exprs []ast.Expr) Form {
+	exprsLen := len(exprs)
+	if exprsLen != 1 && exprsLen != 3 {
+		return FormError{Message: "Expected a module path and optional :as alias"}
+	}
+
+	str, ok := exprs[0].(*ast.String)
+	if !ok {
+		return FormError{Message: "Expected module path string"}
+	}
+
+	alias := strings.TrimSuffix(path.Base(str.Contents), path.Ext(str.Contents))
+
+	if exprsLen == 3 {
+		keyword, err := assertSymbol(exprs[1])
+		if err != nil || keyword != ":as" {
+			return FormError{Message: "Expected :as"}
+		}
+
+		alias, err = assertSymbol(exprs[2])
+		if err != nil {
+			return FormError{Message: "Expected alias symbol"}
+		}
+	}
+
+	return Require{
+		Path:  str.Contents,
+		Alias: alias,
+	}
+}
+
+func whenForm(env *Env, exprs []ast.Expr) Form {
+	if len(exprs) < 2 {
+		return FormError{Message: "Expected condition and body"}
+	}
+
+	return If{
+		Condition: env.Analyze(exprs[0]),
+		Then:      bodyForm(env, exprs[1:]),
+	}
+}
+
+func unlessForm(env *Env, exprs []ast.Expr) Form {
+	if len(exprs) < 2 {
+		return FormError{Message: "Expected condition and body"}
+	}
+
+	return If{
+		Condition: env.Analyze(exprs[0]),
+		Else:      bodyForm(env, exprs[1:]),
+	}
+}
+
+// condForm analyzes (cond (test body...) ... (:else body...)) into nested
+// ifs.
+func condForm(env *Env, exprs []ast.Expr) Form {
+	var form Form
+	for i := len(exprs) - 1; i >= 0; i-- {
+		clause, err := assertList(exprs[i])
+		if err != nil || len(clause) < 2 {
+			return FormError{Message: "Expected (test body...) clause"}
+		}
+
+		if keyword, err := assertSymbol(clause[0]); err == nil && keyword == ":else" {
+			if i != len(exprs)-1 {
+				return FormError{Message: "Expected :else to be the last clause"}
+			}
+			form = bodyForm(env, clause[1:])
+			continue
+		}
+
+		form = If{
+			Condition: env.Analyze(clause[0]),
+			Then:      bodyForm(env, clause[1:]),
+			Else:      form,
+		}
+	}
+
+	if form == nil {
+		return FormError{Message: "Expected clauses"}
+	}
+	return form
+}
+
+// caseForm analyzes (case expr (value body...) ((value...) body...) ...
+// (:else body...)). Values aren't evaluated.
+func caseForm(env *Env, exprs []ast.Expr) Form {
+	if len(exprs) < 1 {
+		return FormError{Message: "Expected expression"}
+	}
+
+	form := Case{
+		Subject: env.Analyze(exprs[0]),
+		Clauses: []CaseClause{},
+	}
+
+	for i, expr := range exprs[1:] {
+		clause, err := assertList(expr)
+		if err != nil || len(clause) < 2 {
+			return FormError{Message: "Expected (value body...) clause"}
+		}
+
+		body := bodyForm(env, clause[1:])
+
+		if keyword, err := assertSymbol(clause[0]); err == nil && keyword == ":else" {
+			if i != len(exprs)-2 {
+				return FormError{Message: "Expected :else to be the last clause"}
+			}
+			form.Default = body
+			continue
+		}
+
+		values := []ast.Expr{clause[0]}
+		if list, err := assertList(clause[0]); err == nil {
+			values = list
+		}
+
+		caseClause := CaseClause{Values: []Form{}, Body: body}
+		for _, value := range values {
+			caseClause.Values = append(caseClause.Values, literal(value))
+		}
+		form.Clauses = append(form.Clauses, caseClause)
+	}
+
+	return form
+}
+
+// literal analyzes an unevaluated value.
+func literal(expr ast.Expr) Form {
+	if sym, err := assertSymbol(expr); err == nil {
+		switch sym {
+		case "nil", "true", "false":
+			return Symbol{Name: sym}
+		}
+	}
+	return Quote{Expr: expr}
+}
+
+// setForm analyzes (set! name value). Whether name is bound is only known
+// when evaluated, as it can be defined later in the program or by the
+// template including it.
+func setForm(env *Env, exprs []ast.Expr) Form {
+	if len(exprs) != 2 {
+		return FormError{Message: "Expected name and value"}
+	}
+
+	name, err := assertSymbol(exprs[0])
+	if err != nil {
+		return FormError{Message: "Expected symbol name"}
+	}
+
+	return Set{
+		Name:  name,
+		Value: env.Analyze(exprs[1]),
+		Span:  ast.SpanOf(exprs[0]),
+	}
+}
+
+// tryForm analyzes (try body... (catch e handler...) (finally cleanup...)),
+// where either catch or finally can be left out.
+func tryForm(env *Env, exprs []ast.Expr) Form {
+	form := Try{}
+	body := []ast.Expr{}
+
+	for i, expr := range exprs {
+		head := ""
+		list, err := assertList(expr)
+		if err == nil && len(list) > 0 {
+			head, _ = assertSymbol(list[0])
+		}
+
+		if head != "catch" && head != "finally" {
+			if form.Catch != nil {
+				return FormError{Message: "Expected catch to come after the body"}
+			}
+			body = append(body, expr)
+			continue
+		}
+
+		switch head {
+		case "catch":
+			if form.Catch != nil || form.Finally != nil {
+				return FormError{Message: "Expected a single catch, before finally"}
+			}
+			if len(list) < 3 {
+				return FormError{Message: "Expected (catch name body...)"}
+			}
+			name, err := assertSymbol(list[1])
+			if err != nil {
+				return FormError{Message: "Expected symbol name"}
+			}
+
+			form.Catch = &Catch{Symbol: name, Body: bodyForm(env, list[2:])}
+
+		case "finally":
+			if i != len(exprs)-1 {
+				return FormError{Message: "Expected finally to be the last clause"}
+			}
+			if len(list) < 2 {
+				return FormError{Message: "Expected (finally body...)"}
+			}
+			form.Finally = bodyForm(env, list[1:])
+		}
+
+		if len(body) == 0 {
+			return FormError{Message: "Expected body before catch and finally"}
+		}
+	}
+
+	if form.Catch == nil && form.Finally == nil {
+		return FormError{Message: "Expected catch or finally"}
+	}
+
+	form.Body = bodyForm(env, body)
+	return form
+}
@@ -1,6 +1,9 @@
 package analysis
 
-import "fmt"
+import (
+	"fmt"
+	"wisp/ast"
+)
 
 type Form interface {
 	String() string
@@ -8,14 +11,20 @@ type Form interface {
 
 type FormError struct {
 	Message string
+	Span    ast.ByteSpan
 }
 
 func (e FormError) String() string {
 	return e.Message
 }
 
+func (e FormError) Error() string {
+	return fmt.Sprintf("%s at %s", e.Message, e.Span)
+}
+
 type Symbol struct {
 	Name string
+	Span ast.ByteSpan
 }
 
 func (symbol Symbol) String() string {
@@ -41,6 +50,7 @@ func (s String) String() string {
 type Call struct {
 	Callee    Form
 	Arguments []Form
+	Span      ast.ByteSpan
 }
 
 func (call Call) String() string {
@@ -65,7 +75,7 @@ func (def Def) String() string {
 }
 
 type Fun struct {
-	Parameters []string
+	Parameters Parameters
 	Body       Form
 }
 
@@ -95,9 +105,18 @@ func (echo Echo) String() string {
 	return fmt.Sprintf("Echo(%+v)", echo.Forms)
 }
 
+// SSE is (sse body...), evaluating body as a stream of server-sent events.
+type SSE struct {
+	Body Form
+}
+
+func (sse SSE) String() string {
+	return fmt.Sprintf("SSE(%s)", sse.Body)
+}
+
 type Defun struct {
 	Name       string
-	Parameters []string
+	Parameters Parameters
 	Body       Form
 }
 
@@ -105,6 +124,7 @@ func (defun Defun) String() string {
 	return fmt.Sprintf("Defun(%+v, %+v, %+v)", defun.Name, defun.Parameters, defun.Body)
 }
 
+// If evaluates to nil when the branch taken is missing.
 type If struct {
 	Condition Form
 	Then      Form
@@ -115,10 +135,189 @@ func (if_ If) String() string {
 	return fmt.Sprintf("If(%+v, %+v, %+v)", if_.Condition, if_.Then, if_.Else)
 }
 
+type Vector struct {
+	Elements []Form
+}
+
+func (vector Vector) String() string {
+	return fmt.Sprintf("Vector(%+v)", vector.Elements)
+}
+
 type Object struct {
 	Entries map[Form]Form
+	Span    ast.ByteSpan
 }
 
 func (obj Object) String() string {
 	return fmt.Sprintf("Object(%+v)", obj.Entries)
 }
+
+type Include struct {
+	Path     Form
+	Bindings Form
+	Span     ast.ByteSpan
+}
+
+func (include Include) String() string {
+	return fmt.Sprintf("Include(%+v, %+v)", include.Path, include.Bindings)
+}
+
+type Extends struct {
+	Path Form
+	Span ast.ByteSpan
+}
+
+func (extends Extends) String() string {
+	return fmt.Sprintf("Extends(%+v)", extends.Path)
+}
+
+type Block struct {
+	Name string
+	Body []Form
+}
+
+func (block Block) String() string {
+	return fmt.Sprintf("Block(%+v, %+v)", block.Name, block.Body)
+}
+
+type Require struct {
+	Path  string
+	Alias string
+}
+
+func (require Require) String() string {
+	return fmt.Sprintf("Require(%+v, %+v)", require.Path, require.Alias)
+}
+
+type Quote struct {
+	Expr ast.Expr
+}
+
+func (quote Quote) String() string {
+	return fmt.Sprintf("Quote(%+v)", quote.Expr)
+}
+
+type Defmacro struct {
+	Name string
+}
+
+func (defmacro Defmacro) String() string {
+	return fmt.Sprintf("Defmacro(%+v)", defmacro.Name)
+}
+
+type Match struct {
+	Scrutinee Form
+	Tree      Decision
+}
+
+func (match Match) String() string {
+	return fmt.Sprintf("Match(%+v, %+v)", match.Scrutinee, match.Tree)
+}
+
+// Access looks Path up in the value of Target, giving the value of Default
+// instead of nil when set.
+type Access struct {
+	Target  Form
+	Path    []Step
+	Default Form
+}
+
+func (access Access) String() string {
+	return fmt.Sprintf("Access(%+v, %s, %+v)", access.Target, formatPath(access.Path), access.Default)
+}
+
+type Parameters struct {
+	Required []string
+	Optional []Parameter
+	// Rest is the name of the list of remaining arguments, if any.
+	Rest     string
+	Keywords []Parameter
+	// Signature is the parameter list as written.
+	Signature string
+}
+
+func (params Parameters) String() string {
+	return params.Signature
+}
+
+type Parameter struct {
+	Name    string
+	Default Form
+}
+
+type Case struct {
+	Subject Form
+	Clauses []CaseClause
+	Default Form
+}
+
+func (case_ Case) String() string {
+	return fmt.Sprintf("Case(%+v, %+v, %+v)", case_.Subject, case_.Clauses, case_.Default)
+}
+
+type CaseClause struct {
+	Values []Form
+	Body   Form
+}
+
+type For struct {
+	Clauses []ForClause
+	Body    Form
+}
+
+func (for_ For) String() string {
+	return fmt.Sprintf("For(%+v, %+v)", for_.Clauses, for_.Body)
+}
+
+// ForClause binds each element of Items to Symbol, destructured by Binds,
+// skipping those for which When is falsy.
+type ForClause struct {
+	Symbol string
+	Binds  []BindPair
+	Items  Form
+	When   Form
+}
+
+type Loop struct {
+	Binds []BindPair
+	Body  Form
+}
+
+func (loop Loop) String() string {
+	return fmt.Sprintf("Loop(%+v, %+v)", loop.Binds, loop.Body)
+}
+
+type Recur struct {
+	Arguments []Form
+}
+
+func (recur Recur) String() string {
+	return fmt.Sprintf("Recur(%+v)", recur.Arguments)
+}
+
+type Set struct {
+	Name  string
+	Value Form
+	Span  ast.ByteSpan
+}
+
+func (set Set) String() string {
+	return fmt.Sprintf("Set(%+v, %+v)", set.Name, set.Value)
+}
+
+type Try struct {
+	Body    Form
+	Catch   *Catch
+	Finally Form
+}
+
+func (try Try) String() string {
+	return fmt.Sprintf("Try(%+v, %+v, %+v)", try.Body, try.Catch, try.Finally)
+}
+
+// Catch evaluates Body with the error, or the value thrown, bound to
+// Symbol.
+type Catch struct {
+	Symbol string
+	Body   Form
+}
@@ -0,0 +1,327 @@
+package analysis
+
+import (
+	"fmt"
+	"slices"
+	"wisp/ast"
+)
+
+// forForm analyzes (for (x items :when test y more-items ...) body...).
+// Each clause iterates within the previous one.
+func forForm(env *Env, exprs []ast.Expr) Form {
+	if len(exprs) < 2 {
+		return FormError{Message: "Expected clauses and body"}
+	}
+
+	clausesSeq, err := assertList(exprs[0])
+	if err != nil {
+		return FormError{Message: "Expected list"}
+	}
+
+	clauses := []ForClause{}
+	for i := 0; i < len(clausesSeq); i += 2 {
+		if i+1 >= len(clausesSeq) {
+			return FormError{Message: "Expected items after binding"}
+		}
+
+		if keyword, err := assertSymbol(clausesSeq[i]); err == nil && keyword == ":when" {
+			if len(clauses) == 0 {
+				return FormError{Message: "Expected a binding before :when"}
+			}
+			last := &clauses[len(clauses)-1]
+			if last.When != nil {
+				return FormError{Message: "Expected a single :when per binding"}
+			}
+			last.When = env.Analyze(clausesSeq[i+1])
+			continue
+		}
+
+		symbol := env.gensym()
+		binds, err := destructure(env, clausesSeq[i], Symbol{Name: symbol})
+		if err != nil {
+			return FormError{Message: err.Error()}
+		}
+
+		clauses = append(clauses, ForClause{
+			Symbol: symbol,
+			Binds:  binds,
+			Items:  env.Analyze(clausesSeq[i+1]),
+		})
+	}
+
+	if len(clauses) == 0 {
+		return FormError{Message: "Expected a binding"}
+	}
+
+	return For{
+		Clauses: clauses,
+		Body:    bodyForm(env, exprs[1:]),
+	}
+}
+
+// loopForm analyzes (loop (name init ...) body...), whose body can start
+// over with new values for the names by (recur value ...) in tail position.
+func loopForm(env *Env, exprs []ast.Expr) Form {
+	if len(exprs) < 2 {
+		return FormError{Message: "Expected binds and body"}
+	}
+
+	bindsSeq, err := assertList(exprs[0])
+	if err != nil {
+		return FormError{Message: "Expected list"}
+	}
+
+	if len(bindsSeq)%2 != 0 {
+		return FormError{Message: "Expected bind pair value"}
+	}
+
+	binds := []BindPair{}
+	for i := 0; i < len(bindsSeq); i += 2 {
+		sym, err := assertSymbol(bindsSeq[i])
+		if err != nil {
+			return FormError{Message: "Expected bind pair symbol"}
+		}
+		binds = append(binds, BindPair{
+			Symbol: sym,
+			Value:  env.Analyze(bindsSeq[i+1]),
+		})
+	}
+
+	env.loops++
+	body := bodyForm(env, exprs[1:])
+	env.loops--
+
+	if err := checkRecur(body, true, len(binds)); err != nil {
+		return FormError{Message: err.Error()}
+	}
+
+	return Loop{
+		Binds: binds,
+		Body:  body,
+	}
+}
+
+func recurForm(env *Env, exprs []ast.Expr) Form {
+	if env.loops == 0 {
+		return FormError{Message: "recur outside of loop"}
+	}
+
+	arguments := []Form{}
+	for _, expr := range exprs {
+		arguments = append(arguments, env.Analyze(expr))
+	}
+
+	return Recur{Arguments: arguments}
+}
+
+// checkRecur makes sure that every recur in form is in tail position of
+// the innermost loop, which has arity bindings. arity is negative where
+// there is no loop to recur to, as in function bodies.
+func checkRecur(form Form, tail bool, arity int) error {
+	check := func(forms ...Form) error {
+		for _, form := range forms {
+			if form == nil {
+				continue
+			}
+			if err := checkRecur(form, false, arity); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	checkTail := func(form Form) error {
+		if form == nil {
+			return nil
+		}
+		return checkRecur(form, tail, arity)
+	}
+
+	switch f := form.(type) {
+	case Recur:
+		if arity < 0 {
+			return fmt.Errorf("recur outside of loop")
+		}
+		if !tail {
+			return fmt.Errorf("recur is not in tail position")
+		}
+		if len(f.Arguments) != arity {
+			return fmt.Errorf("recur expected %d argument(s), got %d", arity, len(f.Arguments))
+		}
+		return check(f.Arguments...)
+
+	case Loop:
+		for _, bind := range f.Binds {
+			if err := check(bind.Value); err != nil {
+				return err
+			}
+		}
+		return checkRecur(f.Body, true, len(f.Binds))
+
+	case If:
+		if err := check(f.Condition); err != nil {
+			return err
+		}
+		if err := checkTail(f.Then); err != nil {
+			return err
+		}
+		return checkTail(f.Else)
+
+	case Do:
+		for i, form := range f.Forms {
+			if i == len(f.Forms)-1 {
+				return checkTail(form)
+			}
+			if err := check(form); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case Let:
+		for _, bind := range f.Binds {
+			if err := check(bind.Value); err != nil {
+				return err
+			}
+		}
+		return checkTail(f.Body)
+
+	case Case:
+		if err := check(f.Subject); err != nil {
+			return err
+		}
+		for _, clause := range f.Clauses {
+			if err := check(clause.Values...); err != nil {
+				return err
+			}
+			if err := checkTail(clause.Body); err != nil {
+				return err
+			}
+		}
+		return checkTail(f.Default)
+
+	case Match:
+		if err := check(f.Scrutinee); err != nil {
+			return err
+		}
+		return checkDecision(f.Tree, tail, arity)
+
+	case Fun:
+		return checkFunction(f.Parameters, f.Body)
+
+	case Defun:
+		return checkFunction(f.Parameters, f.Body)
+
+	case For:
+		for _, clause := range f.Clauses {
+			if err := check(clause.Items, clause.When); err != nil {
+				return err
+			}
+			for _, bind := range clause.Binds {
+				if err := check(bind.Value); err != nil {
+					return err
+				}
+			}
+		}
+		return check(f.Body)
+
+	case Call:
+		if err := check(f.Callee); err != nil {
+			return err
+		}
+		return check(f.Arguments...)
+
+	case Def:
+		return check(f.Body)
+
+	case Set:
+		return check(f.Value)
+
+	case Try:
+		// the body has to return through finally
+		if err := check(f.Body, f.Finally); err != nil {
+			return err
+		}
+		if f.Catch != nil {
+			return check(f.Catch.Body)
+		}
+		return nil
+
+	case Echo:
+		return check(f.Forms...)
+
+	case SSE:
+		return check(f.Body)
+
+	case Vector:
+		return check(f.Elements...)
+
+	case Object:
+		for key, value := range f.Entries {
+			if err := check(key, value); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case Access:
+		return check(f.Target, f.Default)
+
+	case Include:
+		return check(f.Path, f.Bindings)
+
+	case Extends:
+		return check(f.Path)
+
+	case Block:
+		// blocks may be rendered later, by a layout
+		return check(f.Body...)
+	}
+
+	return nil
+}
+
+func checkDecision(decision Decision, tail bool, arity int) error {
+	switch d := decision.(type) {
+	case Test:
+		if err := checkRecur(d.Check.Value, false, arity); err != nil {
+			return err
+		}
+		if err := checkDecision(d.Then, tail, arity); err != nil {
+			return err
+		}
+		return checkDecision(d.Else, tail, arity)
+
+	case Leaf:
+		for _, bind := range d.Binds {
+			if bind.Default == nil {
+				continue
+			}
+			if err := checkRecur(bind.Default, false, arity); err != nil {
+				return err
+			}
+		}
+		if d.Guard != nil {
+			if err := checkRecur(d.Guard, false, arity); err != nil {
+				return err
+			}
+		}
+		if err := checkRecur(d.Body, tail, arity); err != nil {
+			return err
+		}
+		return checkDecision(d.Else, tail, arity)
+	}
+
+	return nil
+}
+
+func checkFunction(params Parameters, body Form) error {
+	for _, param := range slices.Concat(params.Optional, params.Keywords) {
+		if param.Default == nil {
+			continue
+		}
+		if err := checkRecur(param.Default, false, -1); err != nil {
+			return err
+		}
+	}
+	return checkRecur(body, true, -1)
+}
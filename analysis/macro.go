@@ -0,0 +1,253 @@
+package analysis
+
+import (
+	"fmt"
+	"wisp/ast"
+)
+
+// maxExpansionDepth bounds nested macro expansions, so that a macro
+// expanding into itself fails instead of exhausting the stack.
+const maxExpansionDepth = 256
+
+// Macro is a template from ast expressions to an ast expression, expanded
+// during the analysis. Its body may refer to its parameters, quote and
+// quasiquote.
+type Macro struct {
+	Parameters []string
+	Rest       string
+	Body       ast.Expr
+}
+
+func defmacroForm(env *Env, exprs []ast.Expr) Form {
+	if len(exprs) != 3 {
+		return FormError{Message: "Expected name, parameters and body"}
+	}
+
+	name, err := assertSymbol(exprs[0])
+	if err != nil {
+		return FormError{Message: "Expected symbol name"}
+	}
+
+	list, err := assertList(exprs[1])
+	if err != nil {
+		return FormError{Message: "Expected list"}
+	}
+
+	macro := Macro{Parameters: []string{}, Body: exprs[2]}
+	for i := 0; i < len(list); i++ {
+		param, err := assertSymbol(list[i])
+		if err != nil {
+			return FormError{Message: "Expected symbol"}
+		}
+
+		if param == "&" {
+			if i != len(list)-2 {
+				return FormError{Message: "Expected a single parameter after &"}
+			}
+			macro.Rest, err = assertSymbol(list[i+1])
+			if err != nil {
+				return FormError{Message: "Expected symbol"}
+			}
+			break
+		}
+
+		macro.Parameters = append(macro.Parameters, param)
+	}
+
+	env.macros[name] = macro
+	return Defmacro{Name: name}
+}
+
+// expand analyzes the expansion of a macro called at span, which the
+// expressions it makes are located at.
+func (env *Env) expand(macro Macro, span ast.ByteSpan, args []ast.Expr) Form {
+	env.expanding++
+	defer func() { env.expanding-- }()
+
+	if env.expanding > maxExpansionDepth {
+		return FormError{Message: "Macro expansion is too deep"}
+	}
+
+	expansion, err := macro.Expand(span, args)
+	if err != nil {
+		return FormError{Message: err.Error()}
+	}
+
+	return env.Analyze(expansion)
+}
+
+// Expand applies the macro to the unevaluated arguments of a call at span.
+// The lists, vectors and objects it makes are located at the call, so that
+// errors in the expansion point to it.
+func (macro Macro) Expand(span ast.ByteSpan, args []ast.Expr) (ast.Expr, error) {
+	paramsLen := len(macro.Parameters)
+	if len(args) < paramsLen || (macro.Rest == "" && len(args) > paramsLen) {
+		return nil, fmt.Errorf("macro expected %d argument(s), got %d", paramsLen, len(args))
+	}
+
+	bindings := map[string]ast.Expr{}
+	for i, param := range macro.Parameters {
+		bindings[param] = args[i]
+	}
+	if macro.Rest != "" {
+		bindings[macro.Rest] = &ast.List{Elements: args[paramsLen:], Span: span}
+	}
+
+	return expandTemplate(macro.Body, bindings, span)
+}
+
+func expandTemplate(expr ast.Expr, bindings map[string]ast.Expr, span ast.ByteSpan) (ast.Expr, error) {
+	switch e := expr.(type) {
+	case *ast.Symbol:
+		if bound, found := bindings[e.Name]; found {
+			return bound, nil
+		}
+		return nil, fmt.Errorf("macro body refers to '%s', which is not a parameter", e.Name)
+
+	case *ast.Number, *ast.String:
+		return e, nil
+
+	case *ast.List:
+		if arg, ok := quotation(e, "quote"); ok {
+			return arg, nil
+		}
+		if arg, ok := quotation(e, "quasiquote"); ok {
+			return quasiquote(arg, bindings, span)
+		}
+	}
+
+	return nil, fmt.Errorf("macro body should be a parameter or a quoted template")
+}
+
+func quasiquote(expr ast.Expr, bindings map[string]ast.Expr, span ast.ByteSpan) (ast.Expr, error) {
+	switch e := expr.(type) {
+	case *ast.List:
+		if arg, ok := quotation(e, "unquote"); ok {
+			return expandTemplate(arg, bindings, span)
+		}
+		if _, ok := quotation(e, "unquote-splicing"); ok {
+			return nil, fmt.Errorf("unquote-splicing outside of a list")
+		}
+
+		elements, err := quasiquoteElements(e.Elements, bindings, span)
+		if err != nil {
+			return nil, err
+		}
+		return &ast.List{Elements: elements, Span: span}, nil
+
+	case *ast.Vector:
+		elements, err := quasiquoteElements(e.Elements, bindings, span)
+		if err != nil {
+			return nil, err
+		}
+		return &ast.Vector{Elements: elements, Span: span}, nil
+
+	case *ast.Object:
+		entries := map[ast.Expr]ast.Expr{}
+		for key, value := range e.Entries {
+			expandedKey, err := quasiquote(key, bindings, span)
+			if err != nil {
+				return nil, err
+			}
+			expandedValue, err := quasiquote(value, bindings, span)
+			if err != nil {
+				return nil, err
+			}
+			entries[expandedKey] = expandedValue
+		}
+		return &ast.Object{Entries: entries, Span: span}, nil
+
+	default:
+		return e, nil
+	}
+}
+
+func quasiquoteElements(exprs []ast.Expr, bindings map[string]ast.Expr, span ast.ByteSpan) ([]ast.Expr, error) {
+	elements := []ast.Expr{}
+	for _, element := range exprs {
+		if arg, ok := quotation(element, "unquote-splicing"); ok {
+			spliced, err := expandTemplate(arg, bindings, span)
+			if err != nil {
+				return nil, err
+			}
+			list, err := assertList(spliced)
+			if err != nil {
+				return nil, fmt.Errorf("unquote-splicing of a non list")
+			}
+			elements = append(elements, list...)
+			continue
+		}
+
+		expanded, err := quasiquote(element, bindings, span)
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, expanded)
+	}
+	return elements, nil
+}
+
+// quotation matches (name arg), the shape of the reader macros.
+func quotation(expr ast.Expr, name string) (ast.Expr, bool) {
+	list, ok := expr.(*ast.List)
+	if !ok || len(list.Elements) != 2 {
+		return nil, false
+	}
+
+	head, ok := list.Elements[0].(*ast.Symbol)
+	if !ok || head.Name != name {
+		return nil, false
+	}
+
+	return list.Elements[1], true
+}
+
+func macroexpandForm(env *Env, exprs []ast.Expr) Form {
+	if len(exprs) != 1 {
+		return FormError{Message: "Expected a quoted form"}
+	}
+
+	expr, ok := quotation(exprs[0], "quote")
+	if !ok {
+		return FormError{Message: "Expected a quoted form"}
+	}
+
+	for {
+		list, ok := expr.(*ast.List)
+		if !ok || len(list.Elements) < 1 {
+			break
+		}
+		head, ok := list.Elements[0].(*ast.Symbol)
+		if !ok {
+			break
+		}
+		macro, found := env.macros[head.Name]
+		if !found {
+			break
+		}
+
+		expansion, err := macro.Expand(list.Span, list.Elements[1:])
+		if err != nil {
+			return FormError{Message: err.Error()}
+		}
+		expr = expansion
+	}
+
+	return Quote{Expr: expr}
+}
+
+func quoteForm(env *Env, exprs []ast.Expr) Form {
+	if len(exprs) != 1 {
+		return FormError{Message: "Expected 1 expression"}
+	}
+
+	return Quote{Expr: exprs[0]}
+}
+
+func quasiquoteForm(env *Env, exprs []ast.Expr) Form {
+	return FormError{Message: "quasiquote is only supported in macro bodies"}
+}
+
+func unquoteForm(env *Env, exprs []ast.Expr) Form {
+	return FormError{Message: "unquote outside of quasiquote"}
+}
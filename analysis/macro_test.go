@@ -0,0 +1,44 @@
+package analysis
+
+import (
+	"strings"
+	"testing"
+	"wisp/ast"
+)
+
+func analyzeErrors(t *testing.T, src string) []error {
+	t.Helper()
+	lexer := ast.NewFileLexer("test.wisp", src)
+	parser := ast.NewParser(&lexer)
+	program, err := parser.Program()
+	if err != nil {
+		t.Fatalf("parsing: %s", err)
+	}
+
+	env := NewEnv()
+	env.AnalyzeProgram(program)
+	return env.Errors()
+}
+
+func TestMacroErrorLocation(t *testing.T) {
+	const use = "(wrap 1)"
+	tests := []string{
+		"(defmacro wrap (x) `(let ,x))\n" + use,
+		"(defmacro wrap (x y) `(do ,x ,y))\n" + use,
+		"(defmacro wrap (x) `(wrap ,x))\n" + use,
+	}
+
+	for _, src := range tests {
+		errs := analyzeErrors(t, src)
+		if len(errs) != 1 {
+			t.Errorf("%q: %d errors %v, want 1", src, len(errs), errs)
+			continue
+		}
+
+		start := strings.Index(src, use)
+		want := ast.ByteSpan{Start: start, End: start + len(use), File: "test.wisp", Line: 2, Column: 1}
+		if span := errs[0].(FormError).Span; span != want {
+			t.Errorf("%q: error %q at %s, want at %s", src, errs[0], span, want)
+		}
+	}
+}
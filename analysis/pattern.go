@@ -0,0 +1,457 @@
+package analysis
+
+import (
+	"fmt"
+	"strings"
+	"wisp/ast"
+)
+
+// pattern is what a value is matched against, parsed from its syntax:
+//
+//	_                 anything
+//	x                 anything, bound to x
+//	1 "a" nil :k 'sym a value equal to the literal
+//	{p "key" ...}     an object whose "key" matches p
+//	[p q & r]         a list whose elements match p and q, r matching the rest
+//
+// Object and list patterns can end with :or {x default ...}, giving the
+// value bound to x when the one found is nil.
+type pattern interface{}
+
+type wildcardPattern struct{}
+
+type bindPattern struct {
+	name string
+}
+
+type literalPattern struct {
+	value Form
+}
+
+type objectPattern struct {
+	entries  []objectEntry
+	defaults map[string]Form
+}
+
+type objectEntry struct {
+	key     Form
+	pattern pattern
+}
+
+type listPattern struct {
+	elements []pattern
+	rest     pattern
+	defaults map[string]Form
+}
+
+func parsePattern(env *Env, expr ast.Expr) (pattern, error) {
+	switch e := expr.(type) {
+	case *ast.Symbol:
+		switch e.Name {
+		case "_":
+			return wildcardPattern{}, nil
+		case "nil", "true", "false":
+			return literalPattern{value: Symbol{Name: e.Name}}, nil
+		case "&":
+			return nil, fmt.Errorf("unexpected &")
+		}
+		if strings.HasPrefix(e.Name, ":") {
+			// keywords evaluate to themselves, as in case
+			return literalPattern{value: literal(e)}, nil
+		}
+		return bindPattern{name: e.Name}, nil
+
+	case *ast.Number, *ast.String:
+		return literalPattern{value: env.Analyze(e)}, nil
+
+	case *ast.List:
+		if arg, ok := quotation(e, "quote"); ok {
+			return literalPattern{value: Quote{Expr: arg}}, nil
+		}
+		return nil, fmt.Errorf("unexpected list in pattern, use [...] for list patterns")
+
+	case *ast.Object:
+		obj := objectPattern{entries: []objectEntry{}}
+		for patternExpr, keyExpr := range e.Entries {
+			if sym, ok := patternExpr.(*ast.Symbol); ok && sym.Name == ":or" {
+				defaults, err := parseDefaults(env, keyExpr)
+				if err != nil {
+					return nil, err
+				}
+				obj.defaults = defaults
+				continue
+			}
+
+			p, err := parsePattern(env, patternExpr)
+			if err != nil {
+				return nil, err
+			}
+			obj.entries = append(obj.entries, objectEntry{key: env.Analyze(keyExpr), pattern: p})
+		}
+		return obj, nil
+
+	case *ast.Vector:
+		list := listPattern{elements: []pattern{}}
+		elements := e.Elements
+		if len(elements) >= 2 {
+			if sym, ok := elements[len(elements)-2].(*ast.Symbol); ok && sym.Name == ":or" {
+				defaults, err := parseDefaults(env, elements[len(elements)-1])
+				if err != nil {
+					return nil, err
+				}
+				list.defaults = defaults
+				elements = elements[:len(elements)-2]
+			}
+		}
+
+		for i := 0; i < len(elements); i++ {
+			if sym, ok := elements[i].(*ast.Symbol); ok && sym.Name == "&" {
+				if i != len(elements)-2 {
+					return nil, fmt.Errorf("expected a single pattern after &")
+				}
+				rest, err := parsePattern(env, elements[i+1])
+				if err != nil {
+					return nil, err
+				}
+				list.rest = rest
+				break
+			}
+
+			p, err := parsePattern(env, elements[i])
+			if err != nil {
+				return nil, err
+			}
+			list.elements = append(list.elements, p)
+		}
+		return list, nil
+	}
+
+	return nil, fmt.Errorf("invalid pattern %s", ast.Format(expr))
+}
+
+func parseDefaults(env *Env, expr ast.Expr) (map[string]Form, error) {
+	obj, ok := expr.(*ast.Object)
+	if !ok {
+		return nil, fmt.Errorf("expected {name default ...} after :or")
+	}
+
+	defaults := map[string]Form{}
+	for nameExpr, valueExpr := range obj.Entries {
+		name, err := assertSymbol(nameExpr)
+		if err != nil {
+			return nil, fmt.Errorf("expected symbol in :or")
+		}
+		defaults[name] = env.Analyze(valueExpr)
+	}
+	return defaults, nil
+}
+
+// compiler flattens a pattern into the checks a value has to pass, in
+// order, and the variables it binds.
+type compiler struct {
+	checks   []Test
+	binds    []PatternBind
+	defaults map[string]Form
+}
+
+func compilePattern(p pattern) (compiler, error) {
+	c := compiler{defaults: map[string]Form{}}
+	if err := c.compile(p, []Step{}); err != nil {
+		return c, err
+	}
+
+	for name := range c.defaults {
+		if !c.bound(name) {
+			return c, fmt.Errorf("default given for '%s', which is not bound", name)
+		}
+	}
+
+	return c, nil
+}
+
+func (c *compiler) bound(name string) bool {
+	for _, bind := range c.binds {
+		if bind.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *compiler) compile(p pattern, path []Step) error {
+	switch p := p.(type) {
+	case wildcardPattern:
+
+	case bindPattern:
+		if c.bound(p.name) {
+			return fmt.Errorf("'%s' is bound more than once", p.name)
+		}
+		c.binds = append(c.binds, PatternBind{Name: p.name, Path: path, Default: c.defaults[p.name]})
+
+	case literalPattern:
+		c.check(path, Check{Kind: CheckEquals, Value: p.value})
+
+	case objectPattern:
+		c.addDefaults(p.defaults)
+		c.check(path, Check{Kind: CheckObject})
+		for _, entry := range p.entries {
+			c.check(path, Check{Kind: CheckKey, Value: entry.key})
+			if err := c.compile(entry.pattern, extend(path, Step{Kind: StepKey, Key: entry.key})); err != nil {
+				return err
+			}
+		}
+
+	case listPattern:
+		c.addDefaults(p.defaults)
+		length := len(p.elements)
+		if p.rest == nil {
+			c.check(path, Check{Kind: CheckLength, Length: length})
+		} else {
+			c.check(path, Check{Kind: CheckMinLength, Length: length})
+		}
+		for i, element := range p.elements {
+			if err := c.compile(element, extend(path, Step{Kind: StepIndex, Index: i})); err != nil {
+				return err
+			}
+		}
+		if p.rest != nil {
+			if err := c.compile(p.rest, extend(path, Step{Kind: StepRest, Index: length})); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *compiler) addDefaults(defaults map[string]Form) {
+	for name, value := range defaults {
+		c.defaults[name] = value
+	}
+}
+
+func (c *compiler) check(path []Step, check Check) {
+	c.checks = append(c.checks, Test{Path: path, Check: check})
+}
+
+func extend(path []Step, step Step) []Step {
+	extended := make([]Step, 0, len(path)+1)
+	extended = append(extended, path...)
+	return append(extended, step)
+}
+
+// Decision is a node of the tree a match is analyzed into: either a Test,
+// a Leaf or Fail.
+type Decision interface {
+	String() string
+}
+
+// Test continues with Then when the value at Path passes Check, and with
+// Else otherwise.
+type Test struct {
+	Path  []Step
+	Check Check
+	Then  Decision
+	Else  Decision
+}
+
+func (test Test) String() string {
+	return fmt.Sprintf("Test(%s, %+v, %+v, %+v)", formatPath(test.Path), test.Check, test.Then, test.Else)
+}
+
+// Leaf binds the variables of a clause, then evaluates its body unless the
+// guard fails, in which case matching continues with Else.
+type Leaf struct {
+	Binds []PatternBind
+	Guard Form
+	Body  Form
+	Else  Decision
+}
+
+func (leaf Leaf) String() string {
+	return fmt.Sprintf("Leaf(%+v, %+v, %+v, %+v)", leaf.Binds, leaf.Guard, leaf.Body, leaf.Else)
+}
+
+// Fail is reached when no clause matches.
+type Fail struct{}
+
+func (Fail) String() string {
+	return "Fail"
+}
+
+type PatternBind struct {
+	Name    string
+	Path    []Step
+	Default Form
+}
+
+func (bind PatternBind) String() string {
+	return fmt.Sprintf("%s=%s", bind.Name, formatPath(bind.Path))
+}
+
+type StepKind uint8
+
+const (
+	// StepKey looks Key up in an object.
+	StepKey StepKind = iota
+	// StepIndex takes the element at Index of a list.
+	StepIndex
+	// StepRest takes the elements of a list from Index on.
+	StepRest
+)
+
+type Step struct {
+	Kind  StepKind
+	Key   Form
+	Index int
+}
+
+func formatPath(path []Step) string {
+	var sb strings.Builder
+	sb.WriteString("$")
+	for _, step := range path {
+		switch step.Kind {
+		case StepKey:
+			fmt.Fprintf(&sb, "[%v]", step.Key)
+		case StepIndex:
+			fmt.Fprintf(&sb, "[%d]", step.Index)
+		case StepRest:
+			fmt.Fprintf(&sb, "[%d:]", step.Index)
+		}
+	}
+	return sb.String()
+}
+
+type CheckKind uint8
+
+const (
+	// CheckEquals compares the value with Value.
+	CheckEquals CheckKind = iota
+	// CheckObject checks that the value is an object.
+	CheckObject
+	// CheckKey checks that the object has the key Value.
+	CheckKey
+	// CheckLength checks that the value is a list of Length elements.
+	CheckLength
+	// CheckMinLength checks that the value is a list of at least Length
+	// elements.
+	CheckMinLength
+)
+
+type Check struct {
+	Kind   CheckKind
+	Value  Form
+	Length int
+}
+
+// matchForm analyzes (match expr (pattern [:when guard] body...) ...).
+func matchForm(env *Env, exprs []ast.Expr) Form {
+	if len(exprs) < 1 {
+		return FormError{Message: "Expected expression to match"}
+	}
+
+	scrutinee := env.Analyze(exprs[0])
+
+	// the tree is built from the last clause up, each clause falling back
+	// to the ones after it
+	var tree Decision = Fail{}
+	for i := len(exprs) - 1; i >= 1; i-- {
+		decision, err := matchClause(env, exprs[i], tree)
+		if err != nil {
+			return FormError{Message: err.Error()}
+		}
+		tree = decision
+	}
+
+	return Match{
+		Scrutinee: scrutinee,
+		Tree:      tree,
+	}
+}
+
+func matchClause(env *Env, expr ast.Expr, fallback Decision) (Decision, error) {
+	clause, err := assertList(expr)
+	if err != nil || len(clause) < 1 {
+		return nil, fmt.Errorf("expected (pattern body...) clause")
+	}
+
+	p, err := parsePattern(env, clause[0])
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := compilePattern(p)
+	if err != nil {
+		return nil, err
+	}
+
+	rest := clause[1:]
+	var guard Form
+	if len(rest) > 0 {
+		if keyword, err := assertSymbol(rest[0]); err == nil && keyword == ":when" {
+			if len(rest) < 2 {
+				return nil, fmt.Errorf("expected guard after :when")
+			}
+			guard = env.Analyze(rest[1])
+			rest = rest[2:]
+		}
+	}
+
+	if len(rest) < 1 {
+		return nil, fmt.Errorf("expected clause body")
+	}
+
+	var decision Decision = Leaf{
+		Binds: c.binds,
+		Guard: guard,
+		Body:  bodyForm(env, rest),
+		Else:  fallback,
+	}
+	for j := len(c.checks) - 1; j >= 0; j-- {
+		test := c.checks[j]
+		test.Then = decision
+		test.Else = fallback
+		decision = test
+	}
+
+	return decision, nil
+}
+
+// destructure binds the variables of the pattern expr to the parts of
+// value they match, without checking its shape: missing parts are nil.
+func destructure(env *Env, expr ast.Expr, value Form) ([]BindPair, error) {
+	if sym, err := assertSymbol(expr); err == nil {
+		return []BindPair{{Symbol: sym, Value: value}}, nil
+	}
+
+	p, err := parsePattern(env, expr)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := compilePattern(p)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, check := range c.checks {
+		if check.Check.Kind == CheckEquals {
+			return nil, fmt.Errorf("literal patterns are only allowed in match")
+		}
+	}
+
+	tmp := env.gensym()
+	binds := []BindPair{{Symbol: tmp, Value: value}}
+	for _, bind := range c.binds {
+		binds = append(binds, BindPair{
+			Symbol: bind.Name,
+			Value: Access{
+				Target:  Symbol{Name: tmp},
+				Path:    bind.Path,
+				Default: bind.Default,
+			},
+		})
+	}
+
+	return binds, nil
+}
@@ -25,6 +25,7 @@ func (e ExprError) String() string {
 
 type Symbol struct {
 	Name string
+	Span ByteSpan
 }
 
 func (s Symbol) String() string {
@@ -37,6 +38,7 @@ func (s *Symbol) Accept(visitor ExprVisitor) {
 
 type String struct {
 	Contents string
+	Span     ByteSpan
 }
 
 func (s String) String() string {
@@ -49,6 +51,7 @@ func (s *String) Accept(visitor ExprVisitor) {
 
 type Number struct {
 	Number int
+	Span   ByteSpan
 }
 
 func (n Number) String() string {
@@ -61,6 +64,7 @@ func (n *Number) Accept(visitor ExprVisitor) {
 
 type List struct {
 	Elements []Expr
+	Span     ByteSpan
 }
 
 func (e *List) Accept(visitor ExprVisitor) {
@@ -71,8 +75,22 @@ func (e List) String() string {
 	return fmt.Sprintf("List(%v)", e.Elements)
 }
 
+type Vector struct {
+	Elements []Expr
+	Span     ByteSpan
+}
+
+func (v *Vector) Accept(visitor ExprVisitor) {
+	visitor.VisitVector(v)
+}
+
+func (v Vector) String() string {
+	return fmt.Sprintf("Vector(%v)", v.Elements)
+}
+
 type Object struct {
 	Entries map[Expr]Expr
+	Span    ByteSpan
 }
 
 func (o *Object) Accept(visitor ExprVisitor) {
@@ -83,10 +101,30 @@ func (o Object) String() string {
 	return fmt.Sprintf("Obj(%v)", o.Entries)
 }
 
+// SpanOf gives where in the source expr was read from.
+func SpanOf(expr Expr) ByteSpan {
+	switch e := expr.(type) {
+	case *Symbol:
+		return e.Span
+	case *String:
+		return e.Span
+	case *Number:
+		return e.Span
+	case *List:
+		return e.Span
+	case *Vector:
+		return e.Span
+	case *Object:
+		return e.Span
+	}
+	return ByteSpan{}
+}
+
 type ExprVisitor interface {
 	VisitSymbol(symbol *Symbol)
 	VisitNumber(number *Number)
 	VisitString(string *String)
 	VisitList(list *List)
+	VisitVector(vector *Vector)
 	VisitObject(object *Object)
 }
@@ -0,0 +1,56 @@
+package ast
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Format prints an expression back in wisp syntax.
+func Format(expr Expr) string {
+	var sb strings.Builder
+	format(&sb, expr)
+	return sb.String()
+}
+
+func format(sb *strings.Builder, expr Expr) {
+	switch e := expr.(type) {
+	case *Symbol:
+		sb.WriteString(e.Name)
+	case *Number:
+		sb.WriteString(strconv.Itoa(e.Number))
+	case *String:
+		sb.WriteString(strconv.Quote(e.Contents))
+	case *List:
+		sb.WriteByte('(')
+		for i, element := range e.Elements {
+			if i > 0 {
+				sb.WriteByte(' ')
+			}
+			format(sb, element)
+		}
+		sb.WriteByte(')')
+	case *Vector:
+		sb.WriteByte('[')
+		for i, element := range e.Elements {
+			if i > 0 {
+				sb.WriteByte(' ')
+			}
+			format(sb, element)
+		}
+		sb.WriteByte(']')
+	case *Object:
+		// entries are sorted by key, so that objects print the same way
+		// every time
+		entries := make([]string, 0, len(e.Entries))
+		for key, value := range e.Entries {
+			entries = append(entries, Format(key)+" "+Format(value))
+		}
+		slices.Sort(entries)
+		sb.WriteByte('{')
+		sb.WriteString(strings.Join(entries, " "))
+		sb.WriteByte('}')
+	default:
+		sb.WriteString(expr.String())
+	}
+}
@@ -23,6 +23,22 @@ func (t TokenType) String() string {
 		return "TokenLParens"
 	case TokenRParens:
 		return "TokenRParens"
+	case TokenLBrace:
+		return "TokenLBrace"
+	case TokenRBrace:
+		return "TokenRBrace"
+	case TokenLBracket:
+		return "TokenLBracket"
+	case TokenRBracket:
+		return "TokenRBracket"
+	case TokenQuote:
+		return "TokenQuote"
+	case TokenQuasiquote:
+		return "TokenQuasiquote"
+	case TokenUnquote:
+		return "TokenUnquote"
+	case TokenUnquoteSplicing:
+		return "TokenUnquoteSplicing"
 	case TokenError:
 		return "TokenError"
 	case TokenEOF:
@@ -39,6 +55,12 @@ const (
 	TokenRParens
 	TokenLBrace
 	TokenRBrace
+	TokenLBracket
+	TokenRBracket
+	TokenQuote
+	TokenQuasiquote
+	TokenUnquote
+	TokenUnquoteSplicing
 	TokenError
 	TokenEOF
 )
@@ -46,10 +68,30 @@ const (
 type ByteSpan struct {
 	Start int
 	End   int
+	// File is the name of the file read, if any.
+	File string
+	// Line and Column locate Start, both starting at 1.
+	Line   int
+	Column int
 }
 
 func (span ByteSpan) String() string {
-	return fmt.Sprintf("{%d..%d}", span.Start, span.End)
+	if span.Line == 0 {
+		return fmt.Sprintf("%s{%d..%d}", span.File, span.Start, span.End)
+	}
+	if span.File == "" {
+		return fmt.Sprintf("%d:%d", span.Line, span.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", span.File, span.Line, span.Column)
+}
+
+// LineColumn gives the line and column, both starting at 1, of the byte at
+// offset in src.
+func LineColumn(src string, offset int) (int, int) {
+	offset = min(offset, len(src))
+	line := 1 + strings.Count(src[:offset], "\n")
+	column := 1 + offset - (strings.LastIndex(src[:offset], "\n") + 1)
+	return line, column
 }
 
 type Token struct {
@@ -60,14 +102,30 @@ type Token struct {
 
 type Lexer struct {
 	src   string
+	file  string
 	start int
 	index int
+	// line is that of index, starting at lineStart, and startLine and
+	// startColumn those of start.
+	line        int
+	lineStart   int
+	startLine   int
+	startColumn int
 
 	r bufio.Reader
 }
 
 func (lexer *Lexer) save() {
 	lexer.start = lexer.index
+	lexer.startLine = lexer.line
+	lexer.startColumn = 1 + lexer.index - lexer.lineStart
+}
+
+// NewFileLexer lexes src read from file, naming it in the spans of tokens.
+func NewFileLexer(file string, src string) Lexer {
+	lexer := NewLexer(src)
+	lexer.file = file
+	return lexer
 }
 
 func NewLexer(src string) Lexer {
@@ -76,6 +134,7 @@ func NewLexer(src string) Lexer {
 		src:   src,
 		start: 0,
 		index: 0,
+		line:  1,
 		r:     r,
 	}
 }
@@ -92,6 +151,10 @@ func (lexer *Lexer) advance() (rune, error) {
 		return r, err
 	}
 	lexer.index += size
+	if r == '\n' {
+		lexer.line++
+		lexer.lineStart = lexer.index
+	}
 	return r, err
 }
 
@@ -115,8 +178,11 @@ func (lexer *Lexer) whitespaces() {
 
 func (lexer *Lexer) getByteSpan() ByteSpan {
 	return ByteSpan{
-		Start: lexer.start,
-		End:   lexer.index,
+		Start:  lexer.start,
+		End:    lexer.index,
+		File:   lexer.file,
+		Line:   lexer.startLine,
+		Column: lexer.startColumn,
 	}
 }
 
@@ -178,8 +244,23 @@ func (lexer *Lexer) NextToken() Token {
 			tokenType = TokenLBrace
 		case r == '}':
 			tokenType = TokenRBrace
+		case r == '[':
+			tokenType = TokenLBracket
+		case r == ']':
+			tokenType = TokenRBracket
 		case r == '"':
 			return lexer.stringToken()
+		case r == '\'':
+			tokenType = TokenQuote
+		case r == '`':
+			tokenType = TokenQuasiquote
+		case r == ',':
+			if p, err := lexer.peek(); err == nil && p == '@' {
+				lexer.advance()
+				tokenType = TokenUnquoteSplicing
+			} else {
+				tokenType = TokenUnquote
+			}
 		case r == '-':
 			p, err := lexer.peek()
 			if err != nil {
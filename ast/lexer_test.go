@@ -0,0 +1,28 @@
+package ast
+
+import "testing"
+
+func TestSpanLineColumn(t *testing.T) {
+	lexer := NewFileLexer("test.wisp", "(def x 1)\n  (echo\n\"é\" x)")
+	parser := NewParser(&lexer)
+	program, err := parser.Program()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	echo := program[1].(*List)
+	tests := []struct {
+		expr Expr
+		want string
+	}{
+		{program[0], "test.wisp:1:1"},
+		{echo, "test.wisp:2:3"},
+		{echo.Elements[1], "test.wisp:3:1"},
+		{echo.Elements[2], "test.wisp:3:6"},
+	}
+	for _, test := range tests {
+		if got := SpanOf(test.expr).String(); got != test.want {
+			t.Errorf("%s at %s, want %s", Format(test.expr), got, test.want)
+		}
+	}
+}
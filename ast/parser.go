@@ -48,8 +48,12 @@ func (parser *Parser) Expr() (Expr, error) {
 		return nil, fmt.Errorf("unexpected ')'")
 	case TokenRBrace:
 		return nil, fmt.Errorf("unexpected '}'")
+	case TokenRBracket:
+		return nil, fmt.Errorf("unexpected ']'")
 	case TokenLBrace:
 		return parser.obj()
+	case TokenLBracket:
+		return parser.vector()
 	case TokenNumber:
 		return parser.number()
 	case TokenIdentifier:
@@ -58,13 +62,21 @@ func (parser *Parser) Expr() (Expr, error) {
 		return parser.string()
 	case TokenLParens:
 		return parser.list()
+	case TokenQuote:
+		return parser.quoted("quote")
+	case TokenQuasiquote:
+		return parser.quoted("quasiquote")
+	case TokenUnquote:
+		return parser.quoted("unquote")
+	case TokenUnquoteSplicing:
+		return parser.quoted("unquote-splicing")
 	default:
 		panic("unreachable")
 	}
 }
 
 func (parser *Parser) obj() (Expr, error) {
-	_, err := parser.expect(TokenLBrace)
+	open, err := parser.expect(TokenLBrace)
 	if err != nil {
 		return nil, err
 	}
@@ -82,12 +94,12 @@ func (parser *Parser) obj() (Expr, error) {
 		entries[key] = val
 	}
 
-	_, err = parser.expect(TokenRBrace)
+	closing, err := parser.expect(TokenRBrace)
 	if err != nil {
 		return nil, err
 	}
 
-	expr := &Object{Entries: entries}
+	expr := &Object{Entries: entries, Span: spanning(open.ByteSpan, closing.ByteSpan)}
 	return expr, nil
 }
 
@@ -102,7 +114,7 @@ func (parser *Parser) number() (Expr, error) {
 		return nil, err
 	}
 
-	expr := &Number{Number: number}
+	expr := &Number{Number: number, Span: token.ByteSpan}
 	return expr, nil
 }
 
@@ -112,7 +124,7 @@ func (parser *Parser) symbol() (Expr, error) {
 		return nil, err
 	}
 
-	expr := &Symbol{Name: token.Lexeme}
+	expr := &Symbol{Name: token.Lexeme, Span: token.ByteSpan}
 	return expr, nil
 }
 
@@ -122,12 +134,12 @@ func (parser *Parser) string() (Expr, error) {
 		return nil, err
 	}
 
-	expr := &String{Contents: token.Lexeme}
+	expr := &String{Contents: token.Lexeme, Span: token.ByteSpan}
 	return expr, nil
 }
 
 func (parser *Parser) list() (Expr, error) {
-	_, err := parser.expect(TokenLParens)
+	open, err := parser.expect(TokenLParens)
 	if err != nil {
 		return nil, err
 	}
@@ -141,12 +153,57 @@ func (parser *Parser) list() (Expr, error) {
 		elements = append(elements, expr)
 	}
 
-	_, err = parser.expect(TokenRParens)
+	closing, err := parser.expect(TokenRParens)
 	if err != nil {
 		return nil, err
 	}
 
-	return &List{Elements: elements}, nil
+	return &List{Elements: elements, Span: spanning(open.ByteSpan, closing.ByteSpan)}, nil
+}
+
+func (parser *Parser) vector() (Expr, error) {
+	open, err := parser.expect(TokenLBracket)
+	if err != nil {
+		return nil, err
+	}
+
+	elements := make([]Expr, 0)
+	for parser.curr.Type != TokenRBracket {
+		expr, err := parser.Expr()
+		if err != nil {
+			return expr, err
+		}
+		elements = append(elements, expr)
+	}
+
+	closing, err := parser.expect(TokenRBracket)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Vector{Elements: elements, Span: spanning(open.ByteSpan, closing.ByteSpan)}, nil
+}
+
+// quoted reads the expression after a reader macro token, 'x becoming
+// (quote x) and so on.
+func (parser *Parser) quoted(name string) (Expr, error) {
+	token := parser.advance()
+
+	expr, err := parser.Expr()
+	if err != nil {
+		return nil, err
+	}
+
+	return &List{
+		Elements: []Expr{&Symbol{Name: name, Span: token.ByteSpan}, expr},
+		Span:     spanning(token.ByteSpan, SpanOf(expr)),
+	}, nil
+}
+
+// spanning gives the span from the start of open to the end of closing.
+func spanning(open ByteSpan, closing ByteSpan) ByteSpan {
+	open.End = closing.End
+	return open
 }
 
 func (parser *Parser) Program() ([]Expr, error) {
@@ -158,7 +215,9 @@ func (parser *Parser) Program() ([]Expr, error) {
 			break
 		}
 
-		definition, err := parser.list()
+		// any expression, so that the value of a program can be a
+		// literal
+		definition, err := parser.Expr()
 		if err != nil {
 			return nil, err
 		}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"time"
+	"wisp/evaluator"
+)
+
+// config is read from a JSON file, such as
+//
+//	{"address": ":8443", "tls_cert": "cert.pem", "tls_key": "key.pem",
+//	 "read_timeout": "10s", "mode": "prod", "max_body": 1048576}
+//
+// then overridden by WISP_* environment variables, then by flags.
+type config struct {
+	Address         string   `json:"address"`
+	TLSCert         string   `json:"tls_cert"`
+	TLSKey          string   `json:"tls_key"`
+	ReadTimeout     duration `json:"read_timeout"`
+	WriteTimeout    duration `json:"write_timeout"`
+	ShutdownTimeout duration `json:"shutdown_timeout"`
+	Templates       string   `json:"templates"`
+	Script          string   `json:"script"`
+	Public          string   `json:"public"`
+	CacheMaxAge     duration `json:"cache_max_age"`
+	// Mode is "dev" or "prod".
+	Mode          string `json:"mode"`
+	Routes        bool   `json:"routes"`
+	Stream        bool   `json:"stream"`
+	API           bool   `json:"api"`
+	CSRF          bool   `json:"csrf"`
+	ErrorTemplate string `json:"error_template"`
+	MaxBody       int64  `json:"max_body"`
+	MaxMemory     int64  `json:"max_memory"`
+}
+
+func defaultConfig() config {
+	return config{
+		Address:         ":80",
+		ReadTimeout:     duration(30 * time.Second),
+		WriteTimeout:    duration(30 * time.Second),
+		ShutdownTimeout: duration(30 * time.Second),
+		Templates:       "templates",
+		Script:          "index.wisp",
+		Public:          "public",
+		Mode:            "prod",
+		MaxBody:         evaluator.DefaultLimits.MaxBodySize,
+		MaxMemory:       evaluator.DefaultLimits.MaxMemory,
+	}
+}
+
+// duration reads as a string such as "30s" in JSON.
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	return d.Set(s)
+}
+
+func (d *duration) Set(s string) error {
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(parsed)
+	return nil
+}
+
+func (d *duration) String() string {
+	return time.Duration(*d).String()
+}
+
+func (cfg *config) flags(flags *flag.FlagSet) {
+	flags.StringVar(&cfg.Address, "address", cfg.Address, "address to listen on")
+	flags.StringVar(&cfg.TLSCert, "tls-cert", cfg.TLSCert, "certificate file, to serve HTTPS")
+	flags.StringVar(&cfg.TLSKey, "tls-key", cfg.TLSKey, "key file of the certificate")
+	flags.Var(&cfg.ReadTimeout, "read-timeout", "most time to read a request")
+	flags.Var(&cfg.WriteTimeout, "write-timeout", "most time to write a response, but server-sent events")
+	flags.Var(&cfg.ShutdownTimeout, "shutdown-timeout", "most time to wait for requests being handled when shutting down")
+	flags.StringVar(&cfg.Templates, "templates", cfg.Templates, "directory of the scripts and the templates they include")
+	flags.StringVar(&cfg.Script, "script", cfg.Script, "script served, relative to the template root")
+	flags.StringVar(&cfg.Public, "public", cfg.Public, "directory of the static files served under /public/")
+	flags.Var(&cfg.CacheMaxAge, "cache-max-age", "how long clients cache static files requested without their fingerprint")
+	flags.StringVar(&cfg.Mode, "mode", cfg.Mode, "dev to show errors in responses and reload scripts on change, or prod")
+	flags.BoolFunc("dev", "shorthand for -mode dev", func(value string) error {
+		dev, err := strconv.ParseBool(value)
+		if dev {
+			cfg.Mode = "dev"
+		}
+		return err
+	})
+	flags.BoolVar(&cfg.Routes, "routes", cfg.Routes, "serve the routes the script declares with (route method pattern handler)")
+	flags.BoolVar(&cfg.Stream, "stream", cfg.Stream, "send the output of scripts as it is written")
+	flags.BoolVar(&cfg.API, "api", cfg.API, "respond with the value of the script as JSON instead of its output")
+	flags.BoolVar(&cfg.CSRF, "csrf", cfg.CSRF, "reject unsafe requests without a CSRF token, signed with $WISP_CSRF_KEY")
+	flags.StringVar(&cfg.ErrorTemplate, "error-template", cfg.ErrorTemplate, "html/template file served for errors in prod mode")
+	flags.Int64Var(&cfg.MaxBody, "max-body", cfg.MaxBody, "most bytes read of request bodies")
+	flags.Int64Var(&cfg.MaxMemory, "max-memory", cfg.MaxMemory, "bytes of multipart bodies held in memory")
+}
+
+// load reads the config file at path. A missing file is only an error if
+// required.
+func (cfg *config) load(path string, required bool) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && !required {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// environ overrides cfg with the WISP_* variables set.
+func (cfg *config) environ() error {
+	texts := map[string]*string{
+		"WISP_ADDRESS":        &cfg.Address,
+		"WISP_TLS_CERT":       &cfg.TLSCert,
+		"WISP_TLS_KEY":        &cfg.TLSKey,
+		"WISP_TEMPLATES":      &cfg.Templates,
+		"WISP_SCRIPT":         &cfg.Script,
+		"WISP_PUBLIC":         &cfg.Public,
+		"WISP_MODE":           &cfg.Mode,
+		"WISP_ERROR_TEMPLATE": &cfg.ErrorTemplate,
+	}
+	for name, field := range texts {
+		if value, found := os.LookupEnv(name); found {
+			*field = value
+		}
+	}
+
+	durations := map[string]*duration{
+		"WISP_READ_TIMEOUT":     &cfg.ReadTimeout,
+		"WISP_WRITE_TIMEOUT":    &cfg.WriteTimeout,
+		"WISP_SHUTDOWN_TIMEOUT": &cfg.ShutdownTimeout,
+		"WISP_CACHE_MAX_AGE":    &cfg.CacheMaxAge,
+	}
+	for name, field := range durations {
+		if value, found := os.LookupEnv(name); found {
+			if err := field.Set(value); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+	}
+
+	bools := map[string]*bool{
+		"WISP_ROUTES": &cfg.Routes,
+		"WISP_STREAM": &cfg.Stream,
+		"WISP_API":    &cfg.API,
+		"WISP_CSRF":   &cfg.CSRF,
+	}
+	for name, field := range bools {
+		if value, found := os.LookupEnv(name); found {
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			*field = b
+		}
+	}
+
+	ints := map[string]*int64{
+		"WISP_MAX_BODY":   &cfg.MaxBody,
+		"WISP_MAX_MEMORY": &cfg.MaxMemory,
+	}
+	for name, field := range ints {
+		if value, found := os.LookupEnv(name); found {
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			*field = n
+		}
+	}
+	return nil
+}
+
+func (cfg *config) validate() error {
+	if cfg.Mode != "dev" && cfg.Mode != "prod" {
+		return fmt.Errorf("mode %q is neither dev nor prod", cfg.Mode)
+	}
+	if (cfg.TLSCert == "") != (cfg.TLSKey == "") {
+		return errors.New("tls_cert and tls_key go together")
+	}
+	return nil
+}
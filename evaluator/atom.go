@@ -0,0 +1,131 @@
+package evaluator
+
+import (
+	"fmt"
+	"sync"
+)
+
+// ValueAtom is a reference to a value that can be updated atomically, so
+// it can hold state shared by concurrent evaluations.
+type ValueAtom struct {
+	atom *atom
+}
+
+type atom struct {
+	mutex   sync.Mutex
+	value   Value
+	version uint64
+}
+
+func (a ValueAtom) load() (Value, uint64) {
+	a.atom.mutex.Lock()
+	defer a.atom.mutex.Unlock()
+	return a.atom.value, a.atom.version
+}
+
+// compareAndSet stores value unless the atom changed since version.
+func (a ValueAtom) compareAndSet(version uint64, value Value) bool {
+	a.atom.mutex.Lock()
+	defer a.atom.mutex.Unlock()
+	if a.atom.version != version {
+		return false
+	}
+	a.atom.value = value
+	a.atom.version++
+	return true
+}
+
+func (a ValueAtom) String() string {
+	value, _ := a.load()
+	return fmt.Sprintf("<atom %s>", value.String())
+}
+
+func (ValueAtom) IsCallable() bool {
+	return false
+}
+
+func (ValueAtom) Call(ctx *EvaluatorContext, arguments []Value) (Value, error) {
+	panic("Atom is not a callable value")
+}
+
+func (ValueAtom) IsTruthy() bool {
+	return true
+}
+
+func (a ValueAtom) Compare(other Value) bool {
+	o, ok := other.(ValueAtom)
+	return ok && a.atom == o.atom
+}
+
+func newAtom(ctx *EvaluatorContext, arguments []Value) (Value, error) {
+	if err := arity(arguments, 1); err != nil {
+		return nil, err
+	}
+
+	return ValueAtom{atom: &atom{value: arguments[0]}}, nil
+}
+
+func deref(ctx *EvaluatorContext, arguments []Value) (Value, error) {
+	if err := arity(arguments, 1); err != nil {
+		return nil, err
+	}
+
+	a, err := argument[ValueAtom](arguments, 0, "atom")
+	if err != nil {
+		return nil, err
+	}
+
+	value, _ := a.load()
+	return value, nil
+}
+
+func reset(ctx *EvaluatorContext, arguments []Value) (Value, error) {
+	if err := arity(arguments, 2); err != nil {
+		return nil, err
+	}
+
+	a, err := argument[ValueAtom](arguments, 0, "atom")
+	if err != nil {
+		return nil, err
+	}
+
+	a.atom.mutex.Lock()
+	defer a.atom.mutex.Unlock()
+	a.atom.value = arguments[1]
+	a.atom.version++
+
+	return arguments[1], nil
+}
+
+// swap sets the atom to (f value args...). f may be called more than once
+// when other evaluations update the atom concurrently, so it should be free
+// of side effects.
+func swap(ctx *EvaluatorContext, arguments []Value) (Value, error) {
+	if err := atLeast(arguments, 2); err != nil {
+		return nil, err
+	}
+
+	a, err := argument[ValueAtom](arguments, 0, "atom")
+	if err != nil {
+		return nil, err
+	}
+
+	fun := arguments[1]
+	if !fun.IsCallable() {
+		return nil, &TypeError{Position: 2, Expected: "function", Actual: fun}
+	}
+
+	for {
+		value, version := a.load()
+
+		funArguments := append([]Value{value}, arguments[2:]...)
+		updated, err := fun.Call(ctx, funArguments)
+		if err != nil {
+			return nil, err
+		}
+
+		if a.compareAndSet(version, updated) {
+			return updated, nil
+		}
+	}
+}
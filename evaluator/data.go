@@ -0,0 +1,98 @@
+package evaluator
+
+import (
+	"fmt"
+	"wisp/analysis"
+	"wisp/ast"
+)
+
+// unquoted turns a value back into the expression that quotes it.
+func unquoted(value Value) (ast.Expr, error) {
+	switch v := value.(type) {
+	case ValueNil:
+		return &ast.Symbol{Name: "nil"}, nil
+	case ValueNumber:
+		return &ast.Number{Number: v.Number}, nil
+	case ValueBool:
+		return &ast.Symbol{Name: v.String()}, nil
+	case ValueString:
+		return &ast.String{Contents: v.Contents}, nil
+	case ValueSymbol:
+		return &ast.Symbol{Name: v.Name}, nil
+	case ValueList:
+		elements := []ast.Expr{}
+		for _, element := range v.Elements {
+			expr, err := unquoted(element)
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, expr)
+		}
+		return &ast.List{Elements: elements}, nil
+	case ValueObject:
+		entries := map[ast.Expr]ast.Expr{}
+		for key, value := range v.Entries {
+			keyExpr, err := unquoted(key)
+			if err != nil {
+				return nil, err
+			}
+			valueExpr, err := unquoted(value)
+			if err != nil {
+				return nil, err
+			}
+			entries[keyExpr] = valueExpr
+		}
+		return &ast.Object{Entries: entries}, nil
+	default:
+		return nil, fmt.Errorf("%s is not code", value.String())
+	}
+}
+
+// Format prints value in wisp syntax, as read-string reads it back.
+func Format(value Value) (string, error) {
+	expr, err := unquoted(value)
+	if err != nil {
+		return "", err
+	}
+	return ast.Format(expr), nil
+}
+
+func list(ctx *EvaluatorContext, arguments []Value) (Value, error) {
+	return ValueList{Elements: arguments}, nil
+}
+
+// eval evaluates code in a child of the root context, so that definitions
+// made by the code don't leak into the caller.
+func eval(ctx *EvaluatorContext, arguments []Value) (Value, error) {
+	if err := arity(arguments, 1); err != nil {
+		return nil, err
+	}
+
+	expr, err := unquoted(arguments[0])
+	if err != nil {
+		return nil, err
+	}
+
+	sandbox := ctx.topLevel()
+	return sandbox.Eval(analysis.Analyze(expr))
+}
+
+func readString(ctx *EvaluatorContext, arguments []Value) (Value, error) {
+	if err := arity(arguments, 1); err != nil {
+		return nil, err
+	}
+
+	src, err := argument[ValueString](arguments, 0, "string")
+	if err != nil {
+		return nil, err
+	}
+
+	lexer := ast.NewLexer(src.Contents)
+	parser := ast.NewParser(&lexer)
+	expr, err := parser.Expr()
+	if err != nil {
+		return nil, err
+	}
+
+	return quoted(expr)
+}
@@ -0,0 +1,390 @@
+package evaluator
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"wisp/analysis"
+	"wisp/ast"
+)
+
+// ArityError is returned when a function is called with the wrong number
+// of arguments.
+type ArityError struct {
+	// Arity is the number of arguments expected, at least.
+	Arity int
+	Got   int
+
+	// Name and Signature are those of the function called, set by the
+	// call when returned by a builtin.
+	Name      string
+	Signature string
+}
+
+func (e *ArityError) Error() string {
+	if e.Signature != "" {
+		return fmt.Sprintf("%s: expected %s, got %d argument(s)", e.Name, e.Signature, e.Got)
+	}
+	return fmt.Sprintf("arity error, expected %d argument(s), got %d", e.Arity, e.Got)
+}
+
+// TypeError is returned when a value isn't of the type expected.
+type TypeError struct {
+	// Name is the function called, set by the call when returned by a
+	// builtin.
+	Name string
+	// Position is that of the argument, starting at 1, or 0 when the value
+	// isn't an argument.
+	Position int
+	Expected string
+	Actual   Value
+}
+
+func (e *TypeError) Error() string {
+	var sb strings.Builder
+	if e.Name != "" {
+		fmt.Fprintf(&sb, "%s: ", e.Name)
+	}
+	if e.Position > 0 {
+		fmt.Fprintf(&sb, "argument %d ", e.Position)
+	}
+	fmt.Fprintf(&sb, "expected %s, got %s %s", e.Expected, TypeName(e.Actual), repr(e.Actual))
+	return sb.String()
+}
+
+type UnboundError struct {
+	Name string
+}
+
+func (e *UnboundError) Error() string {
+	return fmt.Sprintf("unbound variable '%s'", e.Name)
+}
+
+// TypeName names the type of value in errors.
+func TypeName(value Value) string {
+	switch value.(type) {
+	case ValueNil:
+		return "nil"
+	case ValueNumber:
+		return "number"
+	case ValueBool:
+		return "boolean"
+	case ValueString:
+		return "string"
+	case ValueSymbol:
+		return "symbol"
+	case ValueList:
+		return "list"
+	case ValueObject:
+		return "object"
+	case ValueFun, ValueClosure:
+		return "function"
+	case ValueAtom:
+		return "atom"
+	case ValueError:
+		return "error"
+	}
+	return "value"
+}
+
+func repr(value Value) string {
+	if s, ok := value.(ValueString); ok {
+		return strconv.Quote(s.Contents)
+	}
+	return value.String()
+}
+
+// arity checks that a builtin was given n arguments.
+func arity(arguments []Value, n int) error {
+	if len(arguments) != n {
+		return &ArityError{Arity: n, Got: len(arguments)}
+	}
+	return nil
+}
+
+// atLeast checks that a builtin was given n arguments or more.
+func atLeast(arguments []Value, n int) error {
+	if len(arguments) < n {
+		return &ArityError{Arity: n, Got: len(arguments)}
+	}
+	return nil
+}
+
+// argument gives the argument at index i of a builtin as a T.
+func argument[T Value](arguments []Value, i int, expected string) (T, error) {
+	value, ok := arguments[i].(T)
+	if !ok {
+		return value, &TypeError{Position: i + 1, Expected: expected, Actual: arguments[i]}
+	}
+	return value, nil
+}
+
+// named fills in the function a builtin error comes from. Errors of the
+// calls the builtin made itself, as with eval or swap!, are already located
+// and kept as they are.
+func (fun ValueFun) named(err error, got int) error {
+	var located *Error
+	if errors.As(err, &located) {
+		return err
+	}
+
+	var arityError *ArityError
+	if errors.As(err, &arityError) && arityError.Name == "" {
+		arityError.Name = fun.Name
+		arityError.Signature = fun.Signature
+		arityError.Got = got
+	}
+
+	var typeError *TypeError
+	if errors.As(err, &typeError) && typeError.Name == "" {
+		typeError.Name = fun.Name
+	}
+
+	return err
+}
+
+// Frame is a call being evaluated.
+type Frame struct {
+	Name string
+	// Span is the call site.
+	Span ast.ByteSpan
+}
+
+func (frame Frame) String() string {
+	if frame.Span == (ast.ByteSpan{}) {
+		// called by code without a source, as evaluated by eval
+		return frame.Name
+	}
+	return fmt.Sprintf("%s at %s", frame.Name, frame.Span)
+}
+
+// maxCallDepth bounds the stack, so that runaway recursion fails with an
+// error instead of exhausting the stack of the goroutine.
+const maxCallDepth = 10000
+
+func calleeName(fun Value) string {
+	switch f := fun.(type) {
+	case ValueFun:
+		return f.Name
+	case ValueClosure:
+		return f.name
+	}
+	return TypeName(fun)
+}
+
+// Error is an error of the evaluation, located at the span of the
+// innermost expression that raised it.
+type Error struct {
+	Err  error
+	Span ast.ByteSpan
+	// Stack holds the calls being evaluated when the error was raised,
+	// innermost first.
+	Stack []Frame
+}
+
+func (e *Error) Error() string {
+	if e.Span == (ast.ByteSpan{}) {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%s at %s", e.Err, e.Span)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// StackTrace formats the stack, one call per line.
+func (e *Error) StackTrace() string {
+	var sb strings.Builder
+	for _, frame := range e.Stack {
+		fmt.Fprintf(&sb, "  in %s\n", frame)
+	}
+	return sb.String()
+}
+
+// located attaches span and the stack to err, unless it was already
+// located by a more deeply nested expression. Errors of code without a
+// source, as evaluated by eval, take the first span around them.
+func (ctx *EvaluatorContext) located(err error, span ast.ByteSpan) error {
+	var located *Error
+	if errors.As(err, &located) {
+		if located.Span == (ast.ByteSpan{}) {
+			located.Span = span
+		}
+		return err
+	}
+
+	return &Error{Err: err, Span: span, Stack: stackFrames(ctx.runtime.stack)}
+}
+
+// stackEnds is how many calls are kept at each end of deeper stacks, as
+// with runaway recursion.
+const stackEnds = 20
+
+// stackFrames gives the frames of stack innermost first. The calls in the
+// middle of deep stacks are left out, replaced by a frame counting them.
+func stackFrames(stack []Frame) []Frame {
+	frames := make([]Frame, 0, min(len(stack), 2*stackEnds+1))
+	for i := len(stack) - 1; i >= 0; i-- {
+		if i == len(stack)-1-stackEnds && i > stackEnds {
+			frames = append(frames, Frame{Name: fmt.Sprintf("... %d more calls", i+1-stackEnds)})
+			i = stackEnds - 1
+		}
+		frames = append(frames, stack[i])
+	}
+	return frames
+}
+
+// Thrown is the error of (throw value).
+type Thrown struct {
+	Value Value
+}
+
+func (e *Thrown) Error() string {
+	if v, ok := e.Value.(ValueError); ok {
+		return v.Message
+	}
+	return fmt.Sprintf("uncaught %s", e.Value.String())
+}
+
+// Unwrap gives the original error of a rethrown error value.
+func (e *Thrown) Unwrap() error {
+	if v, ok := e.Value.(ValueError); ok {
+		return v.Err
+	}
+	return nil
+}
+
+// ValueError is an error as seen by programs, in catch.
+type ValueError struct {
+	Message string
+	Span    ast.ByteSpan
+	// Err is the error it was made from, if any.
+	Err error
+}
+
+func (e ValueError) String() string {
+	return e.Message
+}
+
+func (ValueError) IsCallable() bool {
+	return false
+}
+
+func (ValueError) Call(ctx *EvaluatorContext, arguments []Value) (Value, error) {
+	panic("Error is not a callable value")
+}
+
+func (ValueError) IsTruthy() bool {
+	return true
+}
+
+func (e ValueError) Compare(other Value) bool {
+	o, ok := other.(ValueError)
+	return ok && e.Message == o.Message
+}
+
+// errorValue gives what catch binds for err: the value thrown, or the
+// error as a value.
+func errorValue(err error) Value {
+	var thrown *Thrown
+	if errors.As(err, &thrown) {
+		return thrown.Value
+	}
+
+	value := ValueError{Message: err.Error(), Err: err}
+
+	var located *Error
+	if errors.As(err, &located) {
+		value.Message = located.Err.Error()
+		value.Span = located.Span
+	}
+
+	return value
+}
+
+func (ctx *EvaluatorContext) evalTry(form analysis.Try) (Value, error) {
+	value, err := ctx.Eval(form.Body)
+
+	if err != nil && form.Catch != nil {
+		catchCtx := newEvaluatorContext(ctx)
+		catchCtx.def(form.Catch.Symbol, errorValue(err))
+		value, err = catchCtx.Eval(form.Catch.Body)
+	}
+
+	if form.Finally != nil {
+		if _, finallyErr := ctx.Eval(form.Finally); finallyErr != nil {
+			return nil, finallyErr
+		}
+	}
+
+	return value, err
+}
+
+func throw(ctx *EvaluatorContext, arguments []Value) (Value, error) {
+	if err := arity(arguments, 1); err != nil {
+		return nil, err
+	}
+
+	return nil, &Thrown{Value: arguments[0]}
+}
+
+func newError(ctx *EvaluatorContext, arguments []Value) (Value, error) {
+	if err := arity(arguments, 1); err != nil {
+		return nil, err
+	}
+
+	message, err := argument[ValueString](arguments, 0, "string")
+	if err != nil {
+		return nil, err
+	}
+
+	return ValueError{Message: message.Contents}, nil
+}
+
+func isError(ctx *EvaluatorContext, arguments []Value) (Value, error) {
+	if err := arity(arguments, 1); err != nil {
+		return nil, err
+	}
+
+	if _, ok := arguments[0].(ValueError); ok {
+		return TRUE, nil
+	}
+	return FALSE, nil
+}
+
+func errorMessage(ctx *EvaluatorContext, arguments []Value) (Value, error) {
+	if err := arity(arguments, 1); err != nil {
+		return nil, err
+	}
+
+	e, err := argument[ValueError](arguments, 0, "error")
+	if err != nil {
+		return nil, err
+	}
+
+	return ValueString{Contents: e.Message}, nil
+}
+
+// errorLocation gives where an error was raised, as {:file :line :column},
+// or nil for errors made by the program or raised by code without a source.
+func errorLocation(ctx *EvaluatorContext, arguments []Value) (Value, error) {
+	if err := arity(arguments, 1); err != nil {
+		return nil, err
+	}
+
+	e, err := argument[ValueError](arguments, 0, "error")
+	if err != nil {
+		return nil, err
+	}
+
+	if e.Span == (ast.ByteSpan{}) {
+		return NIL, nil
+	}
+	return ValueObject{Entries: map[Value]Value{
+		keyword("file"):   ValueString{Contents: e.Span.File},
+		keyword("line"):   ValueNumber{Number: e.Span.Line},
+		keyword("column"): ValueNumber{Number: e.Span.Column},
+	}}, nil
+}
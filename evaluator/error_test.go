@@ -0,0 +1,46 @@
+package evaluator
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDeepStack(t *testing.T) {
+	_, _, err := run(t, `(defun down (n) (down (inc n))) (down 0)`)
+	var located *Error
+	if !errors.As(err, &located) {
+		t.Fatalf("error %v, want a located error", err)
+	}
+
+	if len(located.Stack) != 2*stackEnds+1 {
+		t.Fatalf("%d frames, want %d", len(located.Stack), 2*stackEnds+1)
+	}
+	if got, want := located.Stack[stackEnds].Name, "... 9960 more calls"; got != want {
+		t.Errorf("frame %d = %q, want %q", stackEnds, got, want)
+	}
+	for i, frame := range located.Stack {
+		if i != stackEnds && frame.Name != "down" {
+			t.Errorf("frame %d = %q, want down", i, frame.Name)
+		}
+	}
+}
+
+func TestErrorLocation(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"(try\n  (+ 1 \"a\")\n  (catch e (let ({f :file l :line c :column} (error-location e)) [f l c])))", "(test.wisp 2 3)"},
+		{`(try (throw (error "no")) (catch e (error-location e)))`, "nil"},
+	}
+
+	for _, test := range tests {
+		value, _, err := run(t, test.src)
+		if err != nil {
+			t.Fatalf("%s: %s", test.src, err)
+		}
+		if got := value.String(); got != test.want {
+			t.Errorf("%s = %s, want %s", test.src, got, test.want)
+		}
+	}
+}
@@ -1,24 +1,90 @@
 package evaluator
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
 	"strconv"
+	"sync"
 	"wisp/analysis"
+	"wisp/ast"
 )
 
 type EvaluatorContext struct {
 	variables map[string]Value
 	closing   *EvaluatorContext
-	w         io.Writer
+	runtime   *runtime
+}
+
+// runtime is the state of a single evaluation, shared by every context that
+// takes part in it.
+type runtime struct {
+	w        io.Writer
+	env      *Environment
+	template *template
+	// requiring is the chain of modules being loaded by this evaluation.
+	requiring []string
+	// stack holds the calls being evaluated, innermost last.
+	stack []Frame
+	// request and response are set when handling an HTTP request.
+	request  *http.Request
+	response *Response
+	// requestJSON is the decoded body of request, once read.
+	requestJSON Value
+	// routes collects the routes declared, when loading them.
+	routes *declaration
+	// sse is set while evaluating the body of (sse body...).
+	sse bool
+	// bodyLimited and formParsed are set once the body of request is
+	// limited and its form parsed.
+	bodyLimited bool
+	formParsed  bool
+	// uploads are the files read with file-upload, copied to tempFiles.
+	uploads   map[string]Value
+	tempFiles []string
+}
+
+// Environment holds what outlives a single evaluation, such as where
+// templates are loaded from and the modules loaded so far.
+type Environment struct {
+	loader Loader
+	limits Limits
+	assets Assets
+
+	mutex   sync.Mutex
+	modules map[string]*module
+}
+
+// Loader resolves template paths into analyzed programs.
+type Loader interface {
+	Load(path string) ([]analysis.Form, error)
+}
+
+// Assets resolves the names of static files into their URLs.
+type Assets interface {
+	URL(name string) (string, error)
+}
+
+// SetAssets sets where (asset-url name) finds static files.
+func (env *Environment) SetAssets(assets Assets) {
+	env.assets = assets
+}
+
+func NewEnvironment(loader Loader) *Environment {
+	return &Environment{
+		loader:  loader,
+		limits:  DefaultLimits,
+		modules: map[string]*module{},
+	}
 }
 
 func newEvaluatorContext(parent *EvaluatorContext) *EvaluatorContext {
 	return &EvaluatorContext{
 		variables: map[string]Value{},
 		closing:   parent,
-		w:         parent.w,
+		runtime:   parent.runtime,
 	}
 }
 
@@ -26,7 +92,7 @@ func (ctx *EvaluatorContext) fetch(name string) (Value, error) {
 	curr := ctx
 	for {
 		if curr == nil {
-			return nil, fmt.Errorf("unbound variable '%s'", name)
+			return nil, &UnboundError{Name: name}
 		}
 
 		value, found := curr.variables[name]
@@ -43,6 +109,41 @@ func (ctx *EvaluatorContext) def(name string, value Value) {
 	ctx.variables[name] = value
 }
 
+// set updates the variable name in the context it was defined in, which
+// must belong to this evaluation: variables of others, such as those
+// captured by routes when declared, are shared by concurrent requests.
+func (ctx *EvaluatorContext) set(name string, value Value) error {
+	for curr := ctx; curr != nil; curr = curr.closing {
+		if _, found := curr.variables[name]; found {
+			if curr.runtime != ctx.runtime {
+				return fmt.Errorf("set! of '%s', which outlives the request: use an atom and swap! instead", name)
+			}
+			curr.variables[name] = value
+			return nil
+		}
+	}
+	return &UnboundError{Name: name}
+}
+
+func (ctx *EvaluatorContext) root() *EvaluatorContext {
+	curr := ctx
+	for curr.closing != nil {
+		curr = curr.closing
+	}
+	return curr
+}
+
+// topLevel creates a context seeing only the definitions of the root
+// context, for code evaluated as part of this evaluation, such as partials.
+// The root can belong to another evaluation, as for route handlers.
+func (ctx *EvaluatorContext) topLevel() *EvaluatorContext {
+	return &EvaluatorContext{
+		variables: map[string]Value{},
+		closing:   ctx.root(),
+		runtime:   ctx.runtime,
+	}
+}
+
 func (ctx *EvaluatorContext) EvalProgram(anal []analysis.Form) (Value, error) {
 	var returnValue Value = NIL
 	for _, form := range anal {
@@ -52,13 +153,18 @@ func (ctx *EvaluatorContext) EvalProgram(anal []analysis.Form) (Value, error) {
 			returnValue = value
 		}
 	}
+
+	if ctx.runtime.template.layout != "" {
+		return ctx.renderLayout()
+	}
+
 	return returnValue, nil
 }
 
 func (ctx *EvaluatorContext) Eval(anal analysis.Form) (Value, error) {
 	switch form := anal.(type) {
 	case analysis.FormError:
-		return nil, fmt.Errorf(form.Message)
+		return nil, ctx.located(errors.New(form.Message), form.Span)
 
 	case analysis.Number:
 		return ValueNumber{form.Value}, nil
@@ -67,25 +173,45 @@ func (ctx *EvaluatorContext) Eval(anal analysis.Form) (Value, error) {
 		return ValueString{form.Contents}, nil
 
 	case analysis.Symbol:
-		return ctx.fetch(form.Name)
+		value, err := ctx.fetch(form.Name)
+		if err != nil {
+			return nil, ctx.located(err, form.Span)
+		}
+		return value, nil
 
 	case analysis.Def:
 		body, err := ctx.Eval(form.Body)
 		if err != nil {
 			return nil, err
 		}
+		if closure, ok := body.(ValueClosure); ok && closure.name == "fun" {
+			// (def f (fun ...)) names the function in stack traces
+			closure.name = form.Name
+			body = closure
+		}
 		ctx.def(form.Name, body)
 		return NIL, nil
 
 	case analysis.Defun:
 		fun := ValueClosure{
-			ctx:        newEvaluatorContext(ctx),
+			ctx:        ctx,
+			name:       form.Name,
 			parameters: form.Parameters,
 			body:       form.Body,
 		}
 		ctx.def(form.Name, fun)
 		return fun, nil
 
+	case analysis.Set:
+		value, err := ctx.Eval(form.Value)
+		if err != nil {
+			return nil, err
+		}
+		if err := ctx.set(form.Name, value); err != nil {
+			return nil, ctx.located(err, form.Span)
+		}
+		return value, nil
+
 	case analysis.Let:
 		letCtx := newEvaluatorContext(ctx)
 		for _, bind := range form.Binds {
@@ -111,7 +237,8 @@ func (ctx *EvaluatorContext) Eval(anal analysis.Form) (Value, error) {
 
 	case analysis.Fun:
 		return ValueClosure{
-			ctx:        newEvaluatorContext(ctx),
+			ctx:        ctx,
+			name:       "fun",
 			parameters: form.Parameters,
 			body:       form.Body,
 		}, nil
@@ -132,18 +259,21 @@ func (ctx *EvaluatorContext) Eval(anal analysis.Form) (Value, error) {
 				arguments = append(arguments, value)
 			}
 
-			return fun.Call(arguments)
+			return ctx.call(fun, arguments, form.Span)
 		} else {
-			return nil, fmt.Errorf("head is not a callable value")
+			return nil, ctx.located(&TypeError{Expected: "function", Actual: fun}, form.Span)
 		}
 
+	case analysis.SSE:
+		return ctx.evalSSE(form)
+
 	case analysis.Echo:
 		for _, form := range form.Forms {
 			value, err := ctx.Eval(form)
 			if err != nil {
 				return nil, err
 			}
-			_, err = fmt.Fprint(ctx.w, value.String())
+			_, err = fmt.Fprint(ctx.runtime.w, value.String())
 			if err != nil {
 				return nil, err
 			}
@@ -155,11 +285,35 @@ func (ctx *EvaluatorContext) Eval(anal analysis.Form) (Value, error) {
 		if err != nil {
 			return nil, err
 		}
+		branch := form.Else
 		if condition.IsTruthy() {
-			return ctx.Eval(form.Then)
-		} else {
-			return ctx.Eval(form.Else)
+			branch = form.Then
+		}
+		if branch == nil {
+			return NIL, nil
+		}
+		return ctx.Eval(branch)
+
+	case analysis.Case:
+		subject, err := ctx.Eval(form.Subject)
+		if err != nil {
+			return nil, err
+		}
+		for _, clause := range form.Clauses {
+			for _, valueForm := range clause.Values {
+				value, err := ctx.Eval(valueForm)
+				if err != nil {
+					return nil, err
+				}
+				if subject.Compare(value) {
+					return ctx.Eval(clause.Body)
+				}
+			}
 		}
+		if form.Default == nil {
+			return NIL, nil
+		}
+		return ctx.Eval(form.Default)
 
 	case analysis.Object:
 		entries := map[Value]Value{}
@@ -169,6 +323,9 @@ func (ctx *EvaluatorContext) Eval(anal analysis.Form) (Value, error) {
 			if err != nil {
 				return nil, err
 			}
+			if err := objectKey(evalKey); err != nil {
+				return nil, ctx.located(err, form.Span)
+			}
 			evalVal, err := ctx.Eval(val)
 			if err != nil {
 				return nil, err
@@ -177,25 +334,173 @@ func (ctx *EvaluatorContext) Eval(anal analysis.Form) (Value, error) {
 		}
 
 		return ValueObject{Entries: entries}, nil
+
+	case analysis.Vector:
+		elements := []Value{}
+
+		for _, element := range form.Elements {
+			value, err := ctx.Eval(element)
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, value)
+		}
+
+		return ValueList{Elements: elements}, nil
+
+	case analysis.Match:
+		return ctx.evalMatch(form)
+
+	case analysis.Try:
+		return ctx.evalTry(form)
+
+	case analysis.For:
+		return ctx.evalFor(form)
+
+	case analysis.Loop:
+		return ctx.evalLoop(form)
+
+	case analysis.Recur:
+		arguments := []Value{}
+		for _, expr := range form.Arguments {
+			value, err := ctx.Eval(expr)
+			if err != nil {
+				return nil, err
+			}
+			arguments = append(arguments, value)
+		}
+		return recur{arguments: arguments}, nil
+
+	case analysis.Access:
+		target, err := ctx.Eval(form.Target)
+		if err != nil {
+			return nil, err
+		}
+		return ctx.access(target, form.Path, form.Default)
+
+	case analysis.Include:
+		return ctx.evalInclude(form)
+
+	case analysis.Extends:
+		return ctx.evalExtends(form)
+
+	case analysis.Block:
+		return ctx.evalBlock(form)
+
+	case analysis.Require:
+		return ctx.evalRequire(form)
+
+	case analysis.Quote:
+		value, err := quoted(form.Expr)
+		if err != nil {
+			return nil, ctx.located(err, ast.SpanOf(form.Expr))
+		}
+		return value, nil
+
+	case analysis.Defmacro:
+		return NIL, nil
 	}
 	panic("unreachable")
 }
 
+// call calls fun from span, recording the call on the stack.
+func (ctx *EvaluatorContext) call(fun Value, arguments []Value, span ast.ByteSpan) (Value, error) {
+	if len(ctx.runtime.stack) >= maxCallDepth {
+		return nil, ctx.located(fmt.Errorf("stack overflow: more than %d nested calls", maxCallDepth), span)
+	}
+
+	ctx.runtime.stack = append(ctx.runtime.stack, Frame{Name: calleeName(fun), Span: span})
+	value, err := fun.Call(ctx, arguments)
+	if err != nil {
+		// located while the frame of the callee is still on the stack
+		err = ctx.located(err, span)
+	}
+	ctx.runtime.stack = ctx.runtime.stack[:len(ctx.runtime.stack)-1]
+	return value, err
+}
+
+// quoted turns quoted data into a value.
+func quoted(expr ast.Expr) (Value, error) {
+	switch e := expr.(type) {
+	case *ast.Number:
+		return ValueNumber{Number: e.Number}, nil
+	case *ast.String:
+		return ValueString{Contents: e.Contents}, nil
+	case *ast.Symbol:
+		return ValueSymbol{Name: e.Name}, nil
+	case *ast.List:
+		return quotedList(e.Elements)
+	case *ast.Vector:
+		return quotedList(e.Elements)
+	case *ast.Object:
+		entries := map[Value]Value{}
+		for key, value := range e.Entries {
+			quotedKey, err := quoted(key)
+			if err != nil {
+				return nil, err
+			}
+			if err := objectKey(quotedKey); err != nil {
+				return nil, err
+			}
+			quotedValue, err := quoted(value)
+			if err != nil {
+				return nil, err
+			}
+			entries[quotedKey] = quotedValue
+		}
+		return ValueObject{Entries: entries}, nil
+	default:
+		return nil, fmt.Errorf("can't evaluate quoted %s", ast.Format(expr))
+	}
+}
+
+// objectKey checks that key can be the key of an object, as lists and
+// objects can't be compared to look them up.
+func objectKey(key Value) error {
+	switch key.(type) {
+	case ValueString, ValueNumber, ValueSymbol, ValueBool, ValueNil:
+		return nil
+	}
+	return &TypeError{Expected: "string, number, symbol, boolean or nil key", Actual: key}
+}
+
+func quotedList(exprs []ast.Expr) (Value, error) {
+	elements := []Value{}
+	for _, expr := range exprs {
+		value, err := quoted(expr)
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, value)
+	}
+	return ValueList{Elements: elements}, nil
+}
+
 func Eval(anal analysis.Form) (Value, error) {
 	return defaultCtx.Eval(anal)
 }
 
-func (ctx *EvaluatorContext) defun(name string, fun func([]Value) (Value, error)) {
-	ctx.variables[name] = ValueFun{Fun: fun}
+// defun defines a builtin, the signature naming its parameters in errors.
+func (ctx *EvaluatorContext) defun(name string, signature string, fun func(*EvaluatorContext, []Value) (Value, error)) {
+	ctx.variables[name] = ValueFun{Name: name, Signature: signature, Fun: fun}
 }
 
 var defaultCtx *EvaluatorContext = NewContextWithWriter(os.Stdout)
 
 func NewContextWithWriter(w io.Writer) *EvaluatorContext {
+	return NewEnvironment(nil).NewContext(w)
+}
+
+// NewContext creates the root context of an evaluation writing to w.
+func (env *Environment) NewContext(w io.Writer) *EvaluatorContext {
 	ctx := &EvaluatorContext{
 		variables: map[string]Value{},
 		closing:   nil,
-		w:         w,
+		runtime: &runtime{
+			w:        w,
+			env:      env,
+			template: &template{},
+		},
 	}
 
 	ctx.def("nil", NIL)
@@ -203,99 +508,114 @@ func NewContextWithWriter(w io.Writer) *EvaluatorContext {
 	ctx.def("false", FALSE)
 	ctx.def("*newline*", ValueString{Contents: "\n"})
 
-	ctx.defun("inc", inc)
-	ctx.defun("nil?", isNil)
-	ctx.defun("atoi", atoi)
-	ctx.defun("+", add)
-	ctx.defun("=", compare)
+	ctx.defun("inc", "(n)", inc)
+	ctx.defun("nil?", "(x)", isNil)
+	ctx.defun("atoi", "(s)", atoi)
+	ctx.defun("+", "(n & ns)", add)
+	ctx.defun("=", "(a b)", compare)
+	ctx.defun("list", "(& xs)", list)
+	ctx.defun("eval", "(code)", eval)
+	ctx.defun("read-string", "(s)", readString)
+	ctx.defun("status!", "(code)", setStatus)
+	ctx.defun("header!", "(name value)", setHeader)
+	ctx.defun("set-cookie!", "(name value &optional options)", setCookie)
+	ctx.defun("redirect!", "(url &optional status)", redirect)
+	ctx.defun("flush!", "()", flush)
+	ctx.defun("sleep", "(ms)", sleep)
+	ctx.defun("send-event", "(name data)", sendEvent)
+	ctx.defun("form-value", "(name)", formValue)
+	ctx.defun("form-values", "(name)", formValues)
+	ctx.defun("file-upload", "(name)", fileUpload)
+	ctx.defun("csrf-token", "()", csrfToken)
+	ctx.defun("asset-url", "(name)", assetURL)
+	ctx.defun("request-json", "()", requestJSON)
+	ctx.defun("route", "(method pattern handler &optional options)", route)
+	ctx.defun("use-middleware", "(middleware & more)", useMiddleware)
+	ctx.defun("with-middleware", "(middleware handler)", withMiddleware)
+	ctx.defun("request", "()", request)
+	ctx.defun("json/encode", "(value &optional options)", encodeJSON)
+	ctx.defun("json/decode", "(s)", decodeJSON)
+	ctx.defun("atom", "(x)", newAtom)
+	ctx.defun("deref", "(atom)", deref)
+	ctx.defun("reset!", "(atom x)", reset)
+	ctx.defun("swap!", "(atom f & args)", swap)
+	ctx.defun("throw", "(x)", throw)
+	ctx.defun("error", "(message)", newError)
+	ctx.defun("error?", "(x)", isError)
+	ctx.defun("error-message", "(error)", errorMessage)
+	ctx.defun("error-location", "(error)", errorLocation)
 
 	return ctx
 }
 
-type ArityError struct {
-	Arity int
-}
-
-func (e *ArityError) Error() string {
-	return fmt.Sprintf("arity error, expected %d argument(s)", e.Arity)
-}
-
-type TypeError struct{}
-
-func (e *TypeError) Error() string {
-	return "type error"
-}
-
-func inc(arguments []Value) (Value, error) {
-	if len(arguments) != 1 {
-		return nil, &ArityError{Arity: 1}
+func inc(ctx *EvaluatorContext, arguments []Value) (Value, error) {
+	if err := arity(arguments, 1); err != nil {
+		return nil, err
 	}
 
-	switch v := arguments[0].(type) {
-	case ValueNumber:
-		result := v.Number + 1
-		return ValueNumber{Number: result}, nil
-	default:
-		return nil, &TypeError{}
+	n, err := argument[ValueNumber](arguments, 0, "number")
+	if err != nil {
+		return nil, err
 	}
+
+	return ValueNumber{Number: n.Number + 1}, nil
 }
 
-func isNil(arguments []Value) (Value, error) {
-	if len(arguments) != 1 {
-		return nil, &ArityError{Arity: 1}
+func isNil(ctx *EvaluatorContext, arguments []Value) (Value, error) {
+	if err := arity(arguments, 1); err != nil {
+		return nil, err
 	}
 
 	switch arguments[0].(type) {
 	case ValueNil:
-		return ValueNumber{Number: 1}, nil
+		return TRUE, nil
 	default:
-		return ValueNumber{Number: 0}, nil
+		return FALSE, nil
 	}
 }
 
-func atoi(arguments []Value) (Value, error) {
-	if len(arguments) != 1 {
-		return nil, &ArityError{Arity: 1}
+func atoi(ctx *EvaluatorContext, arguments []Value) (Value, error) {
+	if err := arity(arguments, 1); err != nil {
+		return nil, err
 	}
 
-	switch v := arguments[0].(type) {
-	case ValueString:
-		number, err := strconv.Atoi(v.Contents)
-		if err != nil {
-			return nil, err
-		}
-		return ValueNumber{Number: number}, nil
-	default:
-		return nil, &TypeError{}
+	s, err := argument[ValueString](arguments, 0, "string")
+	if err != nil {
+		return nil, err
 	}
+
+	number, err := strconv.Atoi(s.Contents)
+	if err != nil {
+		return nil, err
+	}
+	return ValueNumber{Number: number}, nil
 }
 
-func add(arguments []Value) (Value, error) {
+func add(ctx *EvaluatorContext, arguments []Value) (Value, error) {
 	acc := 0
 
-	if len(arguments) < 1 {
-		return nil, &ArityError{Arity: 1}
+	if err := atLeast(arguments, 1); err != nil {
+		return nil, err
 	}
 
-	for _, value := range arguments {
-		switch v := value.(type) {
-		case ValueNumber:
-			acc += v.Number
-		default:
-			return nil, &TypeError{}
+	for i := range arguments {
+		n, err := argument[ValueNumber](arguments, i, "number")
+		if err != nil {
+			return nil, err
 		}
+		acc += n.Number
 	}
 
 	return ValueNumber{Number: acc}, nil
 }
 
-func compare(arguments []Value) (Value, error) {
-	if len(arguments) != 2 {
-		return nil, &ArityError{Arity: 2}
+func compare(ctx *EvaluatorContext, arguments []Value) (Value, error) {
+	if err := arity(arguments, 2); err != nil {
+		return nil, err
 	}
 
 	fst := arguments[0]
-	snd := arguments[0]
+	snd := arguments[1]
 
 	isEq := fst.Compare(snd)
 	if isEq {
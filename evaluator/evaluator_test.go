@@ -0,0 +1,20 @@
+package evaluator
+
+import (
+	"strings"
+	"testing"
+	"wisp/loader"
+)
+
+// run evaluates src, returning its value and its output.
+func run(t *testing.T, src string) (Value, string, error) {
+	t.Helper()
+	program, err := loader.CompileFile("test.wisp", src)
+	if err != nil {
+		t.Fatalf("compiling: %s", err)
+	}
+
+	var output strings.Builder
+	value, err := NewEnvironment(nil).NewContext(&output).EvalProgram(program)
+	return value, output.String(), err
+}
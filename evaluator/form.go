@@ -0,0 +1,238 @@
+package evaluator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+)
+
+// Limits bounds what scripts read of requests.
+type Limits struct {
+	// MaxBodySize is the most bytes read of a request body.
+	MaxBodySize int64
+	// MaxMemory is how much of a multipart body is held in memory, the
+	// rest of its files being stored in temporary files.
+	MaxMemory int64
+}
+
+var DefaultLimits = Limits{
+	MaxBodySize: 10 << 20,
+	MaxMemory:   1 << 20,
+}
+
+// SetLimits sets the limits of the requests evaluated in env.
+func (env *Environment) SetLimits(limits Limits) {
+	env.limits = limits
+}
+
+// body limits the body of the request to MaxBodySize.
+func (ctx *EvaluatorContext) body() io.ReadCloser {
+	r := ctx.runtime.request
+	if !ctx.runtime.bodyLimited {
+		r.Body = http.MaxBytesReader(nil, r.Body, ctx.runtime.env.limits.MaxBodySize)
+		ctx.runtime.bodyLimited = true
+	}
+	return r.Body
+}
+
+// BodyTooLargeError is the error of reading a request body over
+// MaxBodySize.
+type BodyTooLargeError struct {
+	Limit int64
+}
+
+func (e *BodyTooLargeError) Error() string {
+	return fmt.Sprintf("request body larger than %d bytes", e.Limit)
+}
+
+func bodyError(err error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return &BodyTooLargeError{Limit: tooLarge.Limit}
+	}
+	return err
+}
+
+// ParseForm parses the query and the body of r, holding up to MaxMemory of
+// multipart bodies in memory. Bodies over MaxBodySize, once limited with
+// http.MaxBytesReader, fail with a BodyTooLargeError.
+func (limits Limits) ParseForm(r *http.Request) error {
+	var err error
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		err = r.ParseMultipartForm(limits.MaxMemory)
+	} else {
+		err = r.ParseForm()
+	}
+	if err != nil {
+		return bodyError(err)
+	}
+	return nil
+}
+
+// parseForm parses the query and the body of the request, once.
+func (ctx *EvaluatorContext) parseForm() (*http.Request, error) {
+	r := ctx.runtime.request
+	if r == nil {
+		return nil, errNoRequest
+	}
+	if ctx.runtime.formParsed {
+		return r, nil
+	}
+
+	ctx.body()
+	if err := ctx.runtime.env.limits.ParseForm(r); err != nil {
+		return nil, err
+	}
+
+	ctx.runtime.formParsed = true
+	return r, nil
+}
+
+// formValue is the first value of a field of the query or the form posted,
+// nil if there is none.
+func formValue(ctx *EvaluatorContext, arguments []Value) (Value, error) {
+	if err := arity(arguments, 1); err != nil {
+		return nil, err
+	}
+
+	name, err := argument[ValueString](arguments, 0, "string")
+	if err != nil {
+		return nil, err
+	}
+	r, err := ctx.parseForm()
+	if err != nil {
+		return nil, err
+	}
+
+	values := r.Form[name.Contents]
+	if len(values) == 0 {
+		return NIL, nil
+	}
+	return ValueString{Contents: values[0]}, nil
+}
+
+// formValues is the list of every value of a field of the query or the
+// form posted.
+func formValues(ctx *EvaluatorContext, arguments []Value) (Value, error) {
+	if err := arity(arguments, 1); err != nil {
+		return nil, err
+	}
+
+	name, err := argument[ValueString](arguments, 0, "string")
+	if err != nil {
+		return nil, err
+	}
+	r, err := ctx.parseForm()
+	if err != nil {
+		return nil, err
+	}
+
+	values := []Value{}
+	for _, value := range r.Form[name.Contents] {
+		values = append(values, ValueString{Contents: value})
+	}
+	return ValueList{Elements: values}, nil
+}
+
+// fileUpload is the file uploaded in a field of a multipart form, as an
+// object of :name, :size, :content-type and :path, a temporary copy removed
+// once the request is handled. It is nil if no file was uploaded.
+func fileUpload(ctx *EvaluatorContext, arguments []Value) (Value, error) {
+	if err := arity(arguments, 1); err != nil {
+		return nil, err
+	}
+
+	name, err := argument[ValueString](arguments, 0, "string")
+	if err != nil {
+		return nil, err
+	}
+	r, err := ctx.parseForm()
+	if err != nil {
+		return nil, err
+	}
+
+	if upload, found := ctx.runtime.uploads[name.Contents]; found {
+		return upload, nil
+	}
+	if r.MultipartForm == nil || len(r.MultipartForm.File[name.Contents]) == 0 {
+		return NIL, nil
+	}
+	header := r.MultipartForm.File[name.Contents][0]
+
+	file, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	tmp, err := os.CreateTemp("", "wisp-upload-*")
+	if err != nil {
+		return nil, err
+	}
+	ctx.runtime.tempFiles = append(ctx.runtime.tempFiles, tmp.Name())
+	_, err = io.Copy(tmp, file)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	upload := ValueObject{Entries: map[Value]Value{
+		keyword("name"):         ValueString{Contents: header.Filename},
+		keyword("size"):         ValueNumber{Number: int(header.Size)},
+		keyword("content-type"): ValueString{Contents: header.Header.Get("Content-Type")},
+		keyword("path"):         ValueString{Contents: tmp.Name()},
+	}}
+	if ctx.runtime.uploads == nil {
+		ctx.runtime.uploads = map[string]Value{}
+	}
+	ctx.runtime.uploads[name.Contents] = upload
+	return upload, nil
+}
+
+// Close releases what the evaluation of a request holds, such as the
+// temporary files of uploads.
+func (ctx *EvaluatorContext) Close() error {
+	var errs []error
+	for _, name := range ctx.runtime.tempFiles {
+		if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	ctx.runtime.tempFiles = nil
+
+	if r := ctx.runtime.request; r != nil && r.MultipartForm != nil {
+		errs = append(errs, r.MultipartForm.RemoveAll())
+	}
+	return errors.Join(errs...)
+}
+
+type csrfTokenKey struct{}
+
+// WithCSRFToken returns a context carrying token, which (csrf-token) gives
+// the scripts handling requests with that context.
+func WithCSRFToken(parent context.Context, token string) context.Context {
+	return context.WithValue(parent, csrfTokenKey{}, token)
+}
+
+func csrfToken(ctx *EvaluatorContext, arguments []Value) (Value, error) {
+	if err := arity(arguments, 0); err != nil {
+		return nil, err
+	}
+
+	r := ctx.runtime.request
+	if r == nil {
+		return nil, errNoRequest
+	}
+	token, ok := r.Context().Value(csrfTokenKey{}).(string)
+	if !ok {
+		return nil, errors.New("no CSRF token, the server doesn't protect against CSRF")
+	}
+	return ValueString{Contents: token}, nil
+}
@@ -0,0 +1,323 @@
+package evaluator
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Response is what a script sets of the response to the request it
+// handles, its output being the body. It is written once the evaluation
+// succeeds or, when streaming, before the first output.
+type Response struct {
+	Status int
+	Header http.Header
+	// Sent is set once the status and headers are written, after which
+	// they can't change.
+	Sent bool
+	// Flush sends the status, the headers and the output written so far,
+	// the rest of the output being sent as it is written.
+	Flush func() error
+	// Done is closed when responses lasting as long as their request, such
+	// as server-sent events, should end, as when the server shuts down.
+	Done <-chan struct{}
+	// Unbounded lifts the write timeout of the server, for those responses.
+	Unbounded func() error
+}
+
+// ErrShutdown is the error of evaluations ended by Response.Done.
+var ErrShutdown = errors.New("server shutting down")
+
+func NewResponse() *Response {
+	return &Response{
+		Status: http.StatusOK,
+		Header: http.Header{},
+	}
+}
+
+// NewRequestContext creates the root context of an evaluation handling r,
+// writing its output to w and the rest of the response to response.
+func (env *Environment) NewRequestContext(w io.Writer, r *http.Request, response *Response) *EvaluatorContext {
+	ctx := env.NewContext(w)
+	ctx.runtime.request = r
+	ctx.runtime.response = response
+	return ctx
+}
+
+var errNoRequest = errors.New("not handling a request")
+
+// response returns the response to the request, which must not have been
+// sent yet.
+func (ctx *EvaluatorContext) response() (*Response, error) {
+	if ctx.runtime.response == nil {
+		return nil, errNoRequest
+	}
+	if ctx.runtime.response.Sent {
+		return nil, errors.New("response headers already sent")
+	}
+	return ctx.runtime.response, nil
+}
+
+// flush sends the response so far, when the server supports it.
+func flush(ctx *EvaluatorContext, arguments []Value) (Value, error) {
+	if err := arity(arguments, 0); err != nil {
+		return nil, err
+	}
+
+	response := ctx.runtime.response
+	if response == nil {
+		return nil, errNoRequest
+	}
+	if response.Flush != nil {
+		if err := response.Flush(); err != nil {
+			return nil, err
+		}
+	}
+	return NIL, nil
+}
+
+func setStatus(ctx *EvaluatorContext, arguments []Value) (Value, error) {
+	if err := arity(arguments, 1); err != nil {
+		return nil, err
+	}
+
+	status, err := argument[ValueNumber](arguments, 0, "number")
+	if err != nil {
+		return nil, err
+	}
+	// informational statuses can't end a response
+	if status.Number < 200 || status.Number > 599 {
+		return nil, &TypeError{Position: 1, Expected: "status between 200 and 599", Actual: status}
+	}
+
+	response, err := ctx.response()
+	if err != nil {
+		return nil, err
+	}
+	response.Status = status.Number
+	return NIL, nil
+}
+
+func setHeader(ctx *EvaluatorContext, arguments []Value) (Value, error) {
+	if err := arity(arguments, 2); err != nil {
+		return nil, err
+	}
+
+	name, err := argument[ValueString](arguments, 0, "string")
+	if err != nil {
+		return nil, err
+	}
+	value, err := argument[ValueString](arguments, 1, "string")
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := ctx.response()
+	if err != nil {
+		return nil, err
+	}
+	response.Header.Set(name.Contents, value.Contents)
+	return NIL, nil
+}
+
+// setCookie adds a cookie to the response, with options given as an object
+// of :path, :domain, :max-age, :secure, :http-only and :same-site ("lax",
+// "strict" or "none").
+func setCookie(ctx *EvaluatorContext, arguments []Value) (Value, error) {
+	if len(arguments) != 2 && len(arguments) != 3 {
+		return nil, &ArityError{Arity: 2, Got: len(arguments)}
+	}
+
+	name, err := argument[ValueString](arguments, 0, "string")
+	if err != nil {
+		return nil, err
+	}
+	value, err := argument[ValueString](arguments, 1, "string")
+	if err != nil {
+		return nil, err
+	}
+
+	cookie := &http.Cookie{Name: name.Contents, Value: value.Contents}
+	if len(arguments) == 3 {
+		options, err := argument[ValueObject](arguments, 2, "object")
+		if err != nil {
+			return nil, err
+		}
+		if err := cookieOptions(cookie, options); err != nil {
+			return nil, err
+		}
+	}
+	if err := cookie.Valid(); err != nil {
+		return nil, err
+	}
+
+	response, err := ctx.response()
+	if err != nil {
+		return nil, err
+	}
+	response.Header.Add("Set-Cookie", cookie.String())
+	return NIL, nil
+}
+
+func cookieOptions(cookie *http.Cookie, options ValueObject) error {
+	for key, value := range options.Entries {
+		name := optionName(key)
+		switch name {
+		case "path", "domain", "same-site":
+			s, ok := value.(ValueString)
+			if !ok {
+				return fmt.Errorf("cookie option %s expected string, got %s", name, TypeName(value))
+			}
+			switch name {
+			case "path":
+				cookie.Path = s.Contents
+			case "domain":
+				cookie.Domain = s.Contents
+			case "same-site":
+				switch strings.ToLower(s.Contents) {
+				case "lax":
+					cookie.SameSite = http.SameSiteLaxMode
+				case "strict":
+					cookie.SameSite = http.SameSiteStrictMode
+				case "none":
+					cookie.SameSite = http.SameSiteNoneMode
+				default:
+					return fmt.Errorf("invalid same-site %q", s.Contents)
+				}
+			}
+		case "max-age":
+			n, ok := value.(ValueNumber)
+			if !ok {
+				return fmt.Errorf("cookie option %s expected number, got %s", name, TypeName(value))
+			}
+			cookie.MaxAge = n.Number
+		case "secure":
+			cookie.Secure = value.IsTruthy()
+		case "http-only":
+			cookie.HttpOnly = value.IsTruthy()
+		default:
+			return fmt.Errorf("unknown cookie option %s", repr(key))
+		}
+	}
+	return nil
+}
+
+// optionName is the name of an option key, either a keyword or a string.
+func optionName(key Value) string {
+	switch k := key.(type) {
+	case ValueSymbol:
+		return strings.TrimPrefix(k.Name, ":")
+	case ValueString:
+		return k.Contents
+	}
+	return ""
+}
+
+// redirect redirects to url with status, 302 Found by default. The output
+// is still sent as the body, so scripts usually end after redirecting.
+func redirect(ctx *EvaluatorContext, arguments []Value) (Value, error) {
+	if len(arguments) != 1 && len(arguments) != 2 {
+		return nil, &ArityError{Arity: 1, Got: len(arguments)}
+	}
+
+	url, err := argument[ValueString](arguments, 0, "string")
+	if err != nil {
+		return nil, err
+	}
+	status := http.StatusFound
+	if len(arguments) == 2 {
+		n, err := argument[ValueNumber](arguments, 1, "number")
+		if err != nil {
+			return nil, err
+		}
+		if n.Number < 300 || n.Number > 399 {
+			return nil, fmt.Errorf("invalid redirect status %d", n.Number)
+		}
+		status = n.Number
+	}
+
+	response, err := ctx.response()
+	if err != nil {
+		return nil, err
+	}
+	response.Status = status
+	response.Header.Set("Location", url.Contents)
+	return NIL, nil
+}
+
+// canceled returns the error of the context of the request once the
+// client went away, and ErrShutdown once server-sent events should end.
+func (ctx *EvaluatorContext) canceled() error {
+	if ctx.runtime.request == nil {
+		return nil
+	}
+	if err := ctx.runtime.request.Context().Err(); err != nil {
+		return err
+	}
+	if ctx.runtime.sse {
+		select {
+		case <-ctx.runtime.response.Done:
+			return ErrShutdown
+		default:
+		}
+	}
+	return nil
+}
+
+// sleep waits for ms milliseconds, or until the request is canceled.
+func sleep(ctx *EvaluatorContext, arguments []Value) (Value, error) {
+	if err := arity(arguments, 1); err != nil {
+		return nil, err
+	}
+
+	ms, err := argument[ValueNumber](arguments, 0, "number")
+	if err != nil {
+		return nil, err
+	}
+
+	timer := time.NewTimer(time.Duration(ms.Number) * time.Millisecond)
+	defer timer.Stop()
+
+	if ctx.runtime.request == nil {
+		<-timer.C
+		return NIL, nil
+	}
+	var done <-chan struct{}
+	if ctx.runtime.sse {
+		done = ctx.runtime.response.Done
+	}
+	select {
+	case <-timer.C:
+		return NIL, nil
+	case <-ctx.runtime.request.Context().Done():
+		return nil, ctx.canceled()
+	case <-done:
+		return nil, ErrShutdown
+	}
+}
+
+// assetURL is the URL of a static file, fingerprinted with its content so
+// that it can be cached for good.
+func assetURL(ctx *EvaluatorContext, arguments []Value) (Value, error) {
+	if err := arity(arguments, 1); err != nil {
+		return nil, err
+	}
+
+	name, err := argument[ValueString](arguments, 0, "string")
+	if err != nil {
+		return nil, err
+	}
+
+	assets := ctx.runtime.env.assets
+	if assets == nil {
+		return nil, errors.New("no static files are served")
+	}
+	url, err := assets.URL(name.Contents)
+	if err != nil {
+		return nil, err
+	}
+	return ValueString{Contents: url}, nil
+}
@@ -0,0 +1,213 @@
+package evaluator
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"strconv"
+	"strings"
+)
+
+// jsonValue converts value to what encoding/json encodes as JSON. Object
+// keys can be strings, keywords or numbers, and are sorted when encoded.
+func jsonValue(value Value) (any, error) {
+	switch v := value.(type) {
+	case ValueNil:
+		return nil, nil
+	case ValueBool:
+		return v.Bool, nil
+	case ValueNumber:
+		return v.Number, nil
+	case ValueString:
+		return v.Contents, nil
+	case ValueList:
+		elements := make([]any, 0, len(v.Elements))
+		for _, element := range v.Elements {
+			converted, err := jsonValue(element)
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, converted)
+		}
+		return elements, nil
+	case ValueObject:
+		entries := make(map[string]any, len(v.Entries))
+		for key, element := range v.Entries {
+			name, err := jsonKey(key)
+			if err != nil {
+				return nil, err
+			}
+			if _, found := entries[name]; found {
+				return nil, fmt.Errorf("duplicate key %q", name)
+			}
+			converted, err := jsonValue(element)
+			if err != nil {
+				return nil, err
+			}
+			entries[name] = converted
+		}
+		return entries, nil
+	}
+	return nil, fmt.Errorf("can't encode %s as JSON", TypeName(value))
+}
+
+func jsonKey(key Value) (string, error) {
+	switch k := key.(type) {
+	case ValueString:
+		return k.Contents, nil
+	case ValueSymbol:
+		return strings.TrimPrefix(k.Name, ":"), nil
+	case ValueNumber:
+		return strconv.Itoa(k.Number), nil
+	}
+	return "", fmt.Errorf("can't encode %s as a JSON key", TypeName(key))
+}
+
+// fromJSON converts what encoding/json decodes, with numbers as
+// json.Number, to a wisp value. Numbers must be integers.
+func fromJSON(decoded any) (Value, error) {
+	switch v := decoded.(type) {
+	case nil:
+		return NIL, nil
+	case bool:
+		return ValueBool{Bool: v}, nil
+	case json.Number:
+		n, err := strconv.Atoi(v.String())
+		if err != nil {
+			return nil, fmt.Errorf("%s is not an integer", v)
+		}
+		return ValueNumber{Number: n}, nil
+	case string:
+		return ValueString{Contents: v}, nil
+	case []any:
+		elements := make([]Value, 0, len(v))
+		for _, element := range v {
+			converted, err := fromJSON(element)
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, converted)
+		}
+		return ValueList{Elements: elements}, nil
+	case map[string]any:
+		entries := make(map[Value]Value, len(v))
+		for key, element := range v {
+			converted, err := fromJSON(element)
+			if err != nil {
+				return nil, err
+			}
+			entries[ValueString{Contents: key}] = converted
+		}
+		return ValueObject{Entries: entries}, nil
+	}
+	return nil, fmt.Errorf("unexpected JSON value %v", decoded)
+}
+
+// EncodeJSON encodes value as JSON, indented if pretty.
+func EncodeJSON(value Value, pretty bool) ([]byte, error) {
+	converted, err := jsonValue(value)
+	if err != nil {
+		return nil, err
+	}
+	if pretty {
+		return json.MarshalIndent(converted, "", "  ")
+	}
+	return json.Marshal(converted)
+}
+
+// DecodeJSON decodes a single JSON value from r.
+func DecodeJSON(r io.Reader) (Value, error) {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+
+	var decoded any
+	if err := decoder.Decode(&decoded); err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return nil, errors.New("unexpected data after JSON value")
+	}
+	return fromJSON(decoded)
+}
+
+// encodeJSON is (json/encode value {:pretty true}).
+func encodeJSON(ctx *EvaluatorContext, arguments []Value) (Value, error) {
+	if len(arguments) != 1 && len(arguments) != 2 {
+		return nil, &ArityError{Arity: 1, Got: len(arguments)}
+	}
+
+	pretty := false
+	if len(arguments) == 2 {
+		options, err := argument[ValueObject](arguments, 1, "object")
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range options.Entries {
+			if optionName(key) != "pretty" {
+				return nil, fmt.Errorf("unknown option %s", repr(key))
+			}
+			pretty = value.IsTruthy()
+		}
+	}
+
+	encoded, err := EncodeJSON(arguments[0], pretty)
+	if err != nil {
+		return nil, err
+	}
+	return ValueString{Contents: string(encoded)}, nil
+}
+
+func decodeJSON(ctx *EvaluatorContext, arguments []Value) (Value, error) {
+	if err := arity(arguments, 1); err != nil {
+		return nil, err
+	}
+
+	s, err := argument[ValueString](arguments, 0, "string")
+	if err != nil {
+		return nil, err
+	}
+	return DecodeJSON(strings.NewReader(s.Contents))
+}
+
+// requestJSON decodes the body of the request, which must have a JSON
+// content type. The body is read once, later calls returning the same value.
+func requestJSON(ctx *EvaluatorContext, arguments []Value) (Value, error) {
+	if err := arity(arguments, 0); err != nil {
+		return nil, err
+	}
+
+	r := ctx.runtime.request
+	if r == nil {
+		return nil, errNoRequest
+	}
+	if ctx.runtime.requestJSON != nil {
+		return ctx.runtime.requestJSON, nil
+	}
+	if !IsJSON(r.Header.Get("Content-Type")) {
+		return nil, fmt.Errorf("request content type %q is not JSON", r.Header.Get("Content-Type"))
+	}
+
+	body, err := io.ReadAll(ctx.body())
+	if err != nil {
+		return nil, bodyError(err)
+	}
+	value, err := DecodeJSON(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("request body: %w", err)
+	}
+
+	ctx.runtime.requestJSON = value
+	return value, nil
+}
+
+// IsJSON reports whether contentType is application/json or a +json type.
+func IsJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
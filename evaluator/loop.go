@@ -0,0 +1,128 @@
+package evaluator
+
+import "wisp/analysis"
+
+// recur carries the values a loop starts over with. The analysis makes
+// sure it is only produced in tail position, so it is returned up to its
+// loop by the forms in between.
+type recur struct {
+	arguments []Value
+}
+
+func (recur) String() string {
+	return "<recur>"
+}
+
+func (recur) IsCallable() bool {
+	return false
+}
+
+func (recur) Call(ctx *EvaluatorContext, arguments []Value) (Value, error) {
+	panic("Recur is not a callable value")
+}
+
+func (recur) IsTruthy() bool {
+	return true
+}
+
+func (recur) Compare(other Value) bool {
+	return false
+}
+
+func (ctx *EvaluatorContext) evalLoop(form analysis.Loop) (Value, error) {
+	values := []Value{}
+	for _, bind := range form.Binds {
+		value, err := ctx.Eval(bind.Value)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+
+	for {
+		loopCtx := newEvaluatorContext(ctx)
+		for i, bind := range form.Binds {
+			loopCtx.def(bind.Symbol, values[i])
+		}
+
+		value, err := loopCtx.Eval(form.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		r, ok := value.(recur)
+		if !ok {
+			return value, nil
+		}
+		values = r.arguments
+
+		// loops can run for as long as the request, as in (sse ...)
+		if err := ctx.canceled(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// evalFor evaluates the body for every combination of the clauses, in
+// order, collecting its values in a list.
+func (ctx *EvaluatorContext) evalFor(form analysis.For) (Value, error) {
+	results := []Value{}
+	if err := ctx.iterate(form.Clauses, form.Body, &results); err != nil {
+		return nil, err
+	}
+	return ValueList{Elements: results}, nil
+}
+
+func (ctx *EvaluatorContext) iterate(clauses []analysis.ForClause, body analysis.Form, results *[]Value) error {
+	if len(clauses) == 0 {
+		value, err := ctx.Eval(body)
+		if err != nil {
+			return err
+		}
+		*results = append(*results, value)
+		return nil
+	}
+
+	clause := clauses[0]
+	items, err := ctx.Eval(clause.Items)
+	if err != nil {
+		return err
+	}
+
+	var elements []Value
+	switch v := items.(type) {
+	case ValueList:
+		elements = v.Elements
+	case ValueNil:
+	default:
+		return &TypeError{Name: "for", Expected: "list", Actual: items}
+	}
+
+	for _, element := range elements {
+		itemCtx := newEvaluatorContext(ctx)
+		itemCtx.def(clause.Symbol, element)
+		for _, bind := range clause.Binds {
+			value, err := itemCtx.Eval(bind.Value)
+			if err != nil {
+				return err
+			}
+			itemCtx.def(bind.Symbol, value)
+		}
+
+		if clause.When != nil {
+			when, err := itemCtx.Eval(clause.When)
+			if err != nil {
+				return err
+			}
+			if !when.IsTruthy() {
+				continue
+			}
+		}
+
+		if err := itemCtx.iterate(clauses[1:], body, results); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,169 @@
+package evaluator
+
+import (
+	"fmt"
+	"wisp/analysis"
+)
+
+// MatchError is returned when a value matches none of the clauses of a
+// match.
+type MatchError struct {
+	Value Value
+}
+
+func (e *MatchError) Error() string {
+	return fmt.Sprintf("no pattern matched %s", e.Value.String())
+}
+
+func (ctx *EvaluatorContext) evalMatch(form analysis.Match) (Value, error) {
+	value, err := ctx.Eval(form.Scrutinee)
+	if err != nil {
+		return nil, err
+	}
+
+	return ctx.decide(form.Tree, value)
+}
+
+func (ctx *EvaluatorContext) decide(decision analysis.Decision, value Value) (Value, error) {
+	for {
+		switch d := decision.(type) {
+		case analysis.Test:
+			target, err := ctx.follow(value, d.Path)
+			if err != nil {
+				return nil, err
+			}
+
+			passed, err := ctx.check(target, d.Check)
+			if err != nil {
+				return nil, err
+			}
+
+			if passed {
+				decision = d.Then
+			} else {
+				decision = d.Else
+			}
+
+		case analysis.Leaf:
+			matchCtx := newEvaluatorContext(ctx)
+			for _, bind := range d.Binds {
+				bound, err := matchCtx.access(value, bind.Path, bind.Default)
+				if err != nil {
+					return nil, err
+				}
+				matchCtx.def(bind.Name, bound)
+			}
+
+			if d.Guard != nil {
+				guard, err := matchCtx.Eval(d.Guard)
+				if err != nil {
+					return nil, err
+				}
+				if !guard.IsTruthy() {
+					decision = d.Else
+					continue
+				}
+			}
+
+			return matchCtx.Eval(d.Body)
+
+		case analysis.Fail:
+			return nil, &MatchError{Value: value}
+
+		default:
+			panic("unreachable")
+		}
+	}
+}
+
+// follow walks path down from value, giving nil for parts that are
+// missing, including those of values of the wrong shape.
+func (ctx *EvaluatorContext) follow(value Value, path []analysis.Step) (Value, error) {
+	for _, step := range path {
+		switch step.Kind {
+		case analysis.StepKey:
+			obj, ok := value.(ValueObject)
+			if !ok {
+				return NIL, nil
+			}
+			key, err := ctx.Eval(step.Key)
+			if err != nil {
+				return nil, err
+			}
+			if err := objectKey(key); err != nil {
+				return nil, err
+			}
+			value, ok = obj.Entries[key]
+			if !ok {
+				value = NIL
+			}
+
+		case analysis.StepIndex:
+			list, ok := value.(ValueList)
+			if !ok || step.Index >= len(list.Elements) {
+				return NIL, nil
+			}
+			value = list.Elements[step.Index]
+
+		case analysis.StepRest:
+			list, ok := value.(ValueList)
+			rest := []Value{}
+			if ok && step.Index < len(list.Elements) {
+				rest = list.Elements[step.Index:]
+			}
+			value = ValueList{Elements: rest}
+		}
+	}
+
+	return value, nil
+}
+
+// access follows path, evaluating def instead when the value found is nil.
+func (ctx *EvaluatorContext) access(value Value, path []analysis.Step, def analysis.Form) (Value, error) {
+	found, err := ctx.follow(value, path)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, isNil := found.(ValueNil); isNil && def != nil {
+		return ctx.Eval(def)
+	}
+
+	return found, nil
+}
+
+func (ctx *EvaluatorContext) check(value Value, check analysis.Check) (bool, error) {
+	switch check.Kind {
+	case analysis.CheckEquals:
+		expected, err := ctx.Eval(check.Value)
+		if err != nil {
+			return false, err
+		}
+		return value.Compare(expected), nil
+
+	case analysis.CheckObject:
+		_, ok := value.(ValueObject)
+		return ok, nil
+
+	case analysis.CheckKey:
+		key, err := ctx.Eval(check.Value)
+		if err != nil {
+			return false, err
+		}
+		if err := objectKey(key); err != nil {
+			return false, err
+		}
+		_, found := value.(ValueObject).Entries[key]
+		return found, nil
+
+	case analysis.CheckLength:
+		list, ok := value.(ValueList)
+		return ok && len(list.Elements) == check.Length, nil
+
+	case analysis.CheckMinLength:
+		list, ok := value.(ValueList)
+		return ok && len(list.Elements) >= check.Length, nil
+	}
+
+	panic("unreachable")
+}
@@ -0,0 +1,25 @@
+package evaluator
+
+import "testing"
+
+func TestMatchKeyword(t *testing.T) {
+	tests := []struct {
+		subject string
+		want    string
+	}{
+		{":ok", "ok"},
+		{":err", "err"},
+		{":other", "other"},
+	}
+
+	for _, test := range tests {
+		src := "(match " + test.subject + ` (:err "err") (:ok "ok") (_ "other"))`
+		value, _, err := run(t, src)
+		if err != nil {
+			t.Fatalf("%s: %s", src, err)
+		}
+		if value.String() != test.want {
+			t.Errorf("%s = %s, want %s", src, value, test.want)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package evaluator
+
+import (
+	"errors"
+	"strings"
+	"wisp/ast"
+)
+
+// chain wraps handler in middleware, the first being the outermost. Each
+// is called with the request and a next function calling the rest of the
+// chain, handler being called with the arguments of the chain.
+func chain(middleware []Value, handler Value) Value {
+	if len(middleware) == 0 {
+		return handler
+	}
+
+	var call func(ctx *EvaluatorContext, i int, arguments []Value) (Value, error)
+	call = func(ctx *EvaluatorContext, i int, arguments []Value) (Value, error) {
+		if i == len(middleware) {
+			// the frame of the chain, named after handler, stands for it
+			return handler.Call(ctx, arguments)
+		}
+
+		next := ValueFun{
+			Name:      "next",
+			Signature: "()",
+			Fun: func(ctx *EvaluatorContext, nextArguments []Value) (Value, error) {
+				if err := arity(nextArguments, 0); err != nil {
+					return nil, err
+				}
+				return call(ctx, i+1, arguments)
+			},
+		}
+
+		request, err := requestValue(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return ctx.call(middleware[i], []Value{request, next}, ast.ByteSpan{})
+	}
+
+	return ValueFun{
+		Name:      calleeName(handler),
+		Signature: "(& arguments)",
+		Fun: func(ctx *EvaluatorContext, arguments []Value) (Value, error) {
+			return call(ctx, 0, arguments)
+		},
+	}
+}
+
+// MiddlewareNames names the middleware route is served through, outermost
+// first.
+func (route Route) MiddlewareNames() []string {
+	names := make([]string, 0, len(route.Middleware))
+	for _, middleware := range route.Middleware {
+		names = append(names, calleeName(middleware))
+	}
+	return names
+}
+
+// Chain is the handler of route wrapped in its middleware.
+func (route Route) Chain() Value {
+	return chain(route.Middleware, route.Handler)
+}
+
+// useMiddleware adds middleware around the routes declared after it. Only
+// routes go through wisp middleware: scripts evaluated for each request,
+// without declaring routes, can't use it and wrap their own code with
+// with-middleware instead.
+func useMiddleware(ctx *EvaluatorContext, arguments []Value) (Value, error) {
+	if err := atLeast(arguments, 1); err != nil {
+		return nil, err
+	}
+
+	for i, middleware := range arguments {
+		if !middleware.IsCallable() {
+			return nil, &TypeError{Position: i + 1, Expected: "function", Actual: middleware}
+		}
+	}
+
+	if ctx.runtime.routes == nil {
+		return nil, errors.New("middleware can only be used when loading routes")
+	}
+	ctx.runtime.routes.middleware = append(ctx.runtime.routes.middleware, arguments...)
+	return NIL, nil
+}
+
+// withMiddleware is (with-middleware (list m...) handler), handler wrapped
+// in the middleware of the list. It can be called by scripts evaluated for
+// each request as well as declared as a route.
+func withMiddleware(ctx *EvaluatorContext, arguments []Value) (Value, error) {
+	if err := arity(arguments, 2); err != nil {
+		return nil, err
+	}
+
+	list, err := argument[ValueList](arguments, 0, "list")
+	if err != nil {
+		return nil, err
+	}
+	for _, middleware := range list.Elements {
+		if !middleware.IsCallable() {
+			return nil, &TypeError{Position: 1, Expected: "list of functions", Actual: list}
+		}
+	}
+	handler := arguments[1]
+	if !handler.IsCallable() {
+		return nil, &TypeError{Position: 2, Expected: "function", Actual: handler}
+	}
+
+	return chain(list.Elements, handler), nil
+}
+
+// requestValue is the request being handled as an object of :method,
+// :path, :query, :headers, :host and :remote-addr. Query parameters and
+// headers, with lowercase names, map to their first value.
+func requestValue(ctx *EvaluatorContext) (Value, error) {
+	r := ctx.runtime.request
+	if r == nil {
+		return nil, errNoRequest
+	}
+
+	query := map[Value]Value{}
+	for name, values := range r.URL.Query() {
+		query[ValueString{Contents: name}] = ValueString{Contents: values[0]}
+	}
+	headers := map[Value]Value{}
+	for name, values := range r.Header {
+		headers[ValueString{Contents: strings.ToLower(name)}] = ValueString{Contents: values[0]}
+	}
+
+	return ValueObject{Entries: map[Value]Value{
+		keyword("method"):      ValueString{Contents: r.Method},
+		keyword("path"):        ValueString{Contents: r.URL.Path},
+		keyword("query"):       ValueObject{Entries: query},
+		keyword("headers"):     ValueObject{Entries: headers},
+		keyword("host"):        ValueString{Contents: r.Host},
+		keyword("remote-addr"): ValueString{Contents: r.RemoteAddr},
+	}}, nil
+}
+
+func keyword(name string) ValueSymbol {
+	return ValueSymbol{Name: ":" + name}
+}
+
+func request(ctx *EvaluatorContext, arguments []Value) (Value, error) {
+	if err := arity(arguments, 0); err != nil {
+		return nil, err
+	}
+	return requestValue(ctx)
+}
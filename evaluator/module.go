@@ -0,0 +1,75 @@
+package evaluator
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strings"
+	"wisp/analysis"
+)
+
+// module is a file evaluated once per Environment into its own context.
+type module struct {
+	exports map[string]Value
+}
+
+func (ctx *EvaluatorContext) evalRequire(form analysis.Require) (Value, error) {
+	mod, err := ctx.runtime.env.require(ctx.runtime, form.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, value := range mod.exports {
+		ctx.def(form.Alias+"/"+name, value)
+	}
+
+	return NIL, nil
+}
+
+func (env *Environment) require(rt *runtime, name string) (*module, error) {
+	if path.Ext(name) == "" {
+		name += ".wisp"
+	}
+
+	if slices.Contains(rt.requiring, name) {
+		cycle := append(rt.requiring, name)
+		return nil, fmt.Errorf("import cycle: %s", strings.Join(cycle, " -> "))
+	}
+
+	// only the outermost require locks, modules required while loading
+	// another one are loaded by the same evaluation
+	if len(rt.requiring) == 0 {
+		env.mutex.Lock()
+		defer env.mutex.Unlock()
+	}
+
+	if mod, found := env.modules[name]; found {
+		return mod, nil
+	}
+
+	program, err := env.load(name)
+	if err != nil {
+		return nil, err
+	}
+
+	root := env.NewContext(io.Discard)
+	root.runtime.requiring = append(slices.Clone(rt.requiring), name)
+
+	modCtx := newEvaluatorContext(root)
+	if _, err := modCtx.EvalProgram(program); err != nil {
+		return nil, fmt.Errorf("module '%s': %w", name, err)
+	}
+
+	exports := map[string]Value{}
+	for name, value := range modCtx.variables {
+		// names the module itself required aren't re-exported
+		if !strings.Contains(name, "/") {
+			exports[name] = value
+		}
+	}
+
+	mod := &module{exports: exports}
+	env.modules[name] = mod
+	return mod, nil
+}
@@ -0,0 +1,120 @@
+package evaluator
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"wisp/analysis"
+	"wisp/ast"
+)
+
+// Route is a handler declared with (route method pattern handler), called
+// with the wildcards of pattern for the requests it matches.
+type Route struct {
+	Method  string
+	Pattern string
+	Handler Value
+	// Middleware is what the routes declared before it use, outermost
+	// first.
+	Middleware []Value
+	// API responds with the value of the handler instead of its output,
+	// set with the :api option.
+	API bool
+}
+
+// declaration collects the routes declared by a program.
+type declaration struct {
+	routes     []Route
+	middleware []Value
+}
+
+// HandlerName names the handler of route, as stack traces do.
+func (route Route) HandlerName() string {
+	return calleeName(route.Handler)
+}
+
+// DeclareRoutes evaluates program, returning the routes it declares.
+// Their handlers are called later, with Apply, by the evaluation of each
+// request.
+func (env *Environment) DeclareRoutes(program []analysis.Form) ([]Route, error) {
+	ctx := env.NewContext(io.Discard)
+	declared := &declaration{routes: []Route{}}
+	ctx.runtime.routes = declared
+
+	if _, err := ctx.EvalProgram(program); err != nil {
+		return nil, err
+	}
+	return declared.routes, nil
+}
+
+// Apply calls fun with arguments, rendering the layout it extends, if any,
+// as EvalProgram does for programs. The call has no call site, so it only
+// shows as the name of fun in stack traces.
+func (ctx *EvaluatorContext) Apply(fun Value, arguments []Value) (Value, error) {
+	if !fun.IsCallable() {
+		return nil, &TypeError{Expected: "function", Actual: fun}
+	}
+
+	value, err := ctx.call(fun, arguments, ast.ByteSpan{})
+	if err != nil {
+		return nil, err
+	}
+
+	if ctx.runtime.template.layout != "" {
+		return ctx.renderLayout()
+	}
+	return value, nil
+}
+
+// route declares a route, with options given as an object of :api.
+func route(ctx *EvaluatorContext, arguments []Value) (Value, error) {
+	if len(arguments) != 3 && len(arguments) != 4 {
+		return nil, &ArityError{Arity: 3, Got: len(arguments)}
+	}
+
+	method, err := argument[ValueString](arguments, 0, "string")
+	if err != nil {
+		return nil, err
+	}
+	pattern, err := argument[ValueString](arguments, 1, "string")
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(pattern.Contents, "/") {
+		return nil, &TypeError{Position: 2, Expected: "path starting with /", Actual: pattern}
+	}
+	handler := arguments[2]
+	if !handler.IsCallable() {
+		return nil, &TypeError{Position: 3, Expected: "function", Actual: handler}
+	}
+
+	declaring := Route{
+		Method:  strings.ToUpper(method.Contents),
+		Pattern: pattern.Contents,
+		Handler: handler,
+	}
+	if len(arguments) == 4 {
+		options, err := argument[ValueObject](arguments, 3, "object")
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range options.Entries {
+			switch optionName(key) {
+			case "api":
+				declaring.API = value.IsTruthy()
+			default:
+				return nil, fmt.Errorf("unknown route option %s", repr(key))
+			}
+		}
+	}
+
+	if ctx.runtime.routes == nil {
+		return nil, errors.New("routes can only be declared when loading")
+	}
+	declared := ctx.runtime.routes
+	declaring.Middleware = slices.Clone(declared.middleware)
+	declared.routes = append(declared.routes, declaring)
+	return NIL, nil
+}
@@ -0,0 +1,24 @@
+package evaluator
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSetTopLevelDef(t *testing.T) {
+	src := `(def total 0) (for (x [1 2 3]) (set! total (+ total x))) total`
+	value, _, err := run(t, src)
+	if err != nil {
+		t.Fatalf("%s: %s", src, err)
+	}
+	if value.String() != "6" {
+		t.Errorf("%s = %s, want 6", src, value)
+	}
+}
+
+func TestSetUnbound(t *testing.T) {
+	_, _, err := run(t, `(set! missing 1)`)
+	if err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("set! of an unbound name: error %v, want one naming it", err)
+	}
+}
@@ -0,0 +1,96 @@
+package evaluator
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"wisp/analysis"
+)
+
+// evalSSE evaluates the body of (sse body...) as a stream of server-sent
+// events, which send-event writes.
+func (ctx *EvaluatorContext) evalSSE(form analysis.SSE) (Value, error) {
+	response, err := ctx.response()
+	if err != nil {
+		return nil, err
+	}
+	if response.Flush == nil {
+		return nil, errors.New("sse: the server can't stream responses")
+	}
+
+	response.Header.Set("Content-Type", "text/event-stream")
+	response.Header.Set("Cache-Control", "no-cache")
+	// asks proxies such as nginx not to buffer the events
+	response.Header.Set("X-Accel-Buffering", "no")
+	if response.Unbounded != nil {
+		if err := response.Unbounded(); err != nil {
+			return nil, err
+		}
+	}
+	if err := response.Flush(); err != nil {
+		return nil, err
+	}
+
+	ctx.runtime.sse = true
+	defer func() {
+		ctx.runtime.sse = false
+	}()
+
+	if _, err := ctx.Eval(form.Body); err != nil {
+		if errors.Is(err, ErrShutdown) {
+			// ends the stream, clients reconnecting to the next server
+			return NIL, nil
+		}
+		return nil, err
+	}
+	return NIL, nil
+}
+
+// sendEvent writes an event named name, or an unnamed message for nil, and
+// sends it right away. Strings are sent as is, other data as JSON.
+func sendEvent(ctx *EvaluatorContext, arguments []Value) (Value, error) {
+	if err := arity(arguments, 2); err != nil {
+		return nil, err
+	}
+
+	if !ctx.runtime.sse {
+		return nil, errors.New("send-event outside of sse")
+	}
+	if err := ctx.canceled(); err != nil {
+		return nil, err
+	}
+
+	var sb strings.Builder
+	switch name := arguments[0].(type) {
+	case ValueNil:
+	case ValueString:
+		if strings.ContainsAny(name.Contents, "\r\n") {
+			return nil, fmt.Errorf("invalid event name %q", name.Contents)
+		}
+		fmt.Fprintf(&sb, "event: %s\n", name.Contents)
+	default:
+		return nil, &TypeError{Position: 1, Expected: "string or nil", Actual: arguments[0]}
+	}
+
+	data, ok := arguments[1].(ValueString)
+	if !ok {
+		encoded, err := EncodeJSON(arguments[1], false)
+		if err != nil {
+			return nil, err
+		}
+		data = ValueString{Contents: string(encoded)}
+	}
+	lines := strings.Split(strings.ReplaceAll(data.Contents, "\r\n", "\n"), "\n")
+	for _, line := range lines {
+		fmt.Fprintf(&sb, "data: %s\n", line)
+	}
+	sb.WriteString("\n")
+
+	if _, err := fmt.Fprint(ctx.runtime.w, sb.String()); err != nil {
+		return nil, err
+	}
+	if err := ctx.runtime.response.Flush(); err != nil {
+		return nil, err
+	}
+	return NIL, nil
+}
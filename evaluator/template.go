@@ -0,0 +1,153 @@
+package evaluator
+
+import (
+	"fmt"
+	"io"
+	"wisp/analysis"
+	"wisp/ast"
+)
+
+// template is the state of the template being rendered: the layout it
+// extends, if any, and the blocks overridden so far.
+type template struct {
+	layout string
+	// layoutSpan is where the layout was extended.
+	layoutSpan ast.ByteSpan
+	blocks     map[string]block
+	// w is the real output, put aside while a template that extends a
+	// layout is evaluated.
+	w io.Writer
+}
+
+type block struct {
+	ctx  *EvaluatorContext
+	body []analysis.Form
+}
+
+func (env *Environment) load(path string) ([]analysis.Form, error) {
+	if env.loader == nil {
+		return nil, fmt.Errorf("can't load '%s' without a template root", path)
+	}
+	return env.loader.Load(path)
+}
+
+func (ctx *EvaluatorContext) load(pathForm analysis.Form) ([]analysis.Form, error) {
+	value, err := ctx.Eval(pathForm)
+	if err != nil {
+		return nil, err
+	}
+
+	path, ok := value.(ValueString)
+	if !ok {
+		return nil, &TypeError{Expected: "path string", Actual: value}
+	}
+
+	return ctx.runtime.env.load(path.Contents)
+}
+
+func (ctx *EvaluatorContext) evalInclude(form analysis.Include) (Value, error) {
+	program, err := ctx.load(form.Path)
+	if err != nil {
+		return nil, ctx.located(err, form.Span)
+	}
+
+	partialCtx := ctx.topLevel()
+
+	if form.Bindings != nil {
+		bindings, err := ctx.Eval(form.Bindings)
+		if err != nil {
+			return nil, err
+		}
+
+		obj, ok := bindings.(ValueObject)
+		if !ok {
+			return nil, &TypeError{Name: "include", Position: 2, Expected: "object", Actual: bindings}
+		}
+
+		for key, value := range obj.Entries {
+			name, ok := key.(ValueString)
+			if !ok {
+				return nil, &TypeError{Name: "include", Expected: "string binding name", Actual: key}
+			}
+			partialCtx.def(name.Contents, value)
+		}
+	}
+
+	// a partial is a template of its own, its blocks don't leak out
+	outer := ctx.runtime.template
+	ctx.runtime.template = &template{}
+	defer func() { ctx.runtime.template = outer }()
+
+	return partialCtx.EvalProgram(program)
+}
+
+func (ctx *EvaluatorContext) evalExtends(form analysis.Extends) (Value, error) {
+	tmpl := ctx.runtime.template
+	if tmpl.layout != "" {
+		return nil, fmt.Errorf("template already extends '%s'", tmpl.layout)
+	}
+
+	value, err := ctx.Eval(form.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	layout, ok := value.(ValueString)
+	if !ok {
+		return nil, &TypeError{Name: "extends", Position: 1, Expected: "string", Actual: value}
+	}
+
+	// only blocks are rendered, and only by the layout
+	tmpl.layout = layout.Contents
+	tmpl.layoutSpan = form.Span
+	tmpl.w = ctx.runtime.w
+	ctx.runtime.w = io.Discard
+
+	return NIL, nil
+}
+
+func (ctx *EvaluatorContext) evalBlock(form analysis.Block) (Value, error) {
+	tmpl := ctx.runtime.template
+
+	if tmpl.layout != "" {
+		// the template closest to the one being rendered wins
+		if _, found := tmpl.blocks[form.Name]; !found {
+			if tmpl.blocks == nil {
+				tmpl.blocks = map[string]block{}
+			}
+			tmpl.blocks[form.Name] = block{ctx: ctx, body: form.Body}
+		}
+		return NIL, nil
+	}
+
+	override, found := tmpl.blocks[form.Name]
+	if !found {
+		override = block{ctx: ctx, body: form.Body}
+	}
+
+	blockCtx := newEvaluatorContext(override.ctx)
+	var returnValue Value = NIL
+	for _, form := range override.body {
+		value, err := blockCtx.Eval(form)
+		if err != nil {
+			return nil, err
+		}
+		returnValue = value
+	}
+	return returnValue, nil
+}
+
+func (ctx *EvaluatorContext) renderLayout() (Value, error) {
+	tmpl := ctx.runtime.template
+	layout := tmpl.layout
+
+	tmpl.layout = ""
+	ctx.runtime.w = tmpl.w
+
+	program, err := ctx.runtime.env.load(layout)
+	if err != nil {
+		return nil, ctx.located(err, tmpl.layoutSpan)
+	}
+
+	return newEvaluatorContext(ctx).EvalProgram(program)
+}
@@ -0,0 +1,47 @@
+package evaluator
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"wisp/ast"
+	"wisp/loader"
+)
+
+func TestMissingTemplate(t *testing.T) {
+	tests := []string{
+		`(include "nope.wisp")`,
+		`(extends "nope.wisp")`,
+	}
+
+	for _, src := range tests {
+		root := t.TempDir()
+		if err := os.WriteFile(filepath.Join(root, "page.wisp"), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		templates := loader.NewLoader(root)
+		program, err := templates.Load("page.wisp")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = NewEnvironment(templates).NewContext(io.Discard).EvalProgram(program)
+		var located *Error
+		if !errors.As(err, &located) {
+			t.Errorf("%s: error %v, want a located error", src, err)
+			continue
+		}
+
+		start := strings.Index(src, `"nope.wisp"`)
+		want := ast.ByteSpan{Start: start, End: start + len(`"nope.wisp"`), File: "page.wisp", Line: 1, Column: start + 1}
+		if located.Span != want {
+			t.Errorf("%s: error at %s, want at %s", src, located.Span, want)
+		}
+		if strings.Contains(err.Error(), root) {
+			t.Errorf("%s: error %q shows the template root", src, err)
+		}
+	}
+}
@@ -2,18 +2,20 @@ package evaluator
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 	"wisp/analysis"
 )
 
 var (
 	NIL   = ValueNil{}
-	TRUE  = ValueNumber{Number: 1}
-	FALSE = ValueNumber{Number: 0}
+	TRUE  = ValueBool{Bool: true}
+	FALSE = ValueBool{Bool: false}
 )
 
 type Value interface {
 	IsCallable() bool
-	Call(arguments []Value) (Value, error)
+	Call(ctx *EvaluatorContext, arguments []Value) (Value, error)
 
 	Compare(other Value) bool
 
@@ -32,7 +34,7 @@ func (ValueNil) IsCallable() bool {
 	return false
 }
 
-func (ValueNil) Call(arguments []Value) (Value, error) {
+func (ValueNil) Call(ctx *EvaluatorContext, arguments []Value) (Value, error) {
 	panic("Nil is not a callable value")
 }
 
@@ -57,7 +59,7 @@ func (ValueNumber) IsCallable() bool {
 	return false
 }
 
-func (ValueNumber) Call(arguments []Value) (Value, error) {
+func (ValueNumber) Call(ctx *EvaluatorContext, arguments []Value) (Value, error) {
 	panic("Number is not a callable value")
 }
 
@@ -73,6 +75,34 @@ func (n ValueNumber) Compare(other Value) bool {
 	return n.Number == m.Number
 }
 
+type ValueBool struct {
+	Bool bool
+}
+
+func (b ValueBool) String() string {
+	return strconv.FormatBool(b.Bool)
+}
+
+func (ValueBool) IsCallable() bool {
+	return false
+}
+
+func (ValueBool) Call(ctx *EvaluatorContext, arguments []Value) (Value, error) {
+	panic("Bool is not a callable value")
+}
+
+func (b ValueBool) IsTruthy() bool {
+	return b.Bool
+}
+
+func (b ValueBool) Compare(other Value) bool {
+	o, ok := other.(ValueBool)
+	if !ok {
+		return false
+	}
+	return b.Bool == o.Bool
+}
+
 type ValueString struct {
 	Contents string
 }
@@ -85,7 +115,7 @@ func (ValueString) IsCallable() bool {
 	return false
 }
 
-func (ValueString) Call(arguments []Value) (Value, error) {
+func (ValueString) Call(ctx *EvaluatorContext, arguments []Value) (Value, error) {
 	panic("String is not a callable value")
 }
 
@@ -103,7 +133,9 @@ func (s ValueString) Compare(other Value) bool {
 }
 
 type ValueFun struct {
-	Fun func([]Value) (Value, error)
+	Name      string
+	Signature string
+	Fun       func(*EvaluatorContext, []Value) (Value, error)
 }
 
 func (ValueFun) String() string {
@@ -114,8 +146,12 @@ func (ValueFun) IsCallable() bool {
 	return true
 }
 
-func (fun ValueFun) Call(arguments []Value) (Value, error) {
-	return fun.Fun(arguments)
+func (fun ValueFun) Call(ctx *EvaluatorContext, arguments []Value) (Value, error) {
+	value, err := fun.Fun(ctx, arguments)
+	if err != nil {
+		return nil, fun.named(err, len(arguments))
+	}
+	return value, nil
 }
 
 func (ValueFun) IsTruthy() bool {
@@ -129,7 +165,8 @@ func (ValueFun) Compare(other Value) bool {
 
 type ValueClosure struct {
 	ctx        *EvaluatorContext
-	parameters []string
+	name       string
+	parameters analysis.Parameters
 	body       analysis.Form
 }
 
@@ -141,17 +178,20 @@ func (ValueClosure) IsCallable() bool {
 	return true
 }
 
-func (closure ValueClosure) Call(arguments []Value) (Value, error) {
-	arity := len(closure.parameters)
-	if len(arguments) != arity {
-		panic("arity error")
+// Call evaluates the closure body in a fresh frame over the context it was
+// created in, writing to the output of the caller.
+func (closure ValueClosure) Call(ctx *EvaluatorContext, arguments []Value) (Value, error) {
+	frame := &EvaluatorContext{
+		variables: map[string]Value{},
+		closing:   closure.ctx,
+		runtime:   ctx.runtime,
 	}
 
-	for i, param := range closure.parameters {
-		closure.ctx.def(param, arguments[i])
+	if err := closure.bind(frame, arguments); err != nil {
+		return nil, err
 	}
 
-	body, err := closure.ctx.Eval(closure.body)
+	body, err := frame.Eval(closure.body)
 	if err != nil {
 		return nil, err
 	}
@@ -159,6 +199,93 @@ func (closure ValueClosure) Call(arguments []Value) (Value, error) {
 	return body, nil
 }
 
+// bind defines the parameters in frame. Defaults are evaluated in frame,
+// so they can refer to the parameters before them.
+func (closure ValueClosure) bind(frame *EvaluatorContext, arguments []Value) error {
+	params := closure.parameters
+	arityError := &ArityError{
+		Arity:     len(params.Required),
+		Name:      closure.name,
+		Signature: params.Signature,
+		Got:       len(arguments),
+	}
+
+	if len(arguments) < len(params.Required) {
+		return arityError
+	}
+	for i, param := range params.Required {
+		frame.def(param, arguments[i])
+	}
+	arguments = arguments[len(params.Required):]
+
+	for _, param := range params.Optional {
+		if len(arguments) > 0 {
+			frame.def(param.Name, arguments[0])
+			arguments = arguments[1:]
+			continue
+		}
+		if err := frame.defDefault(param); err != nil {
+			return err
+		}
+	}
+
+	if params.Rest != "" {
+		frame.def(params.Rest, ValueList{Elements: arguments})
+	} else if len(params.Keywords) == 0 && len(arguments) > 0 {
+		return arityError
+	}
+
+	if len(params.Keywords) == 0 {
+		return nil
+	}
+
+	given := map[string]Value{}
+	if len(arguments)%2 != 0 {
+		return fmt.Errorf("%s: expected keyword arguments in pairs", closure.name)
+	}
+	for i := 0; i < len(arguments); i += 2 {
+		keyword, ok := arguments[i].(ValueSymbol)
+		if !ok || !strings.HasPrefix(keyword.Name, ":") {
+			return fmt.Errorf("%s: expected keyword, got %s", closure.name, arguments[i].String())
+		}
+		given[keyword.Name[1:]] = arguments[i+1]
+	}
+
+	for _, param := range params.Keywords {
+		if value, found := given[param.Name]; found {
+			frame.def(param.Name, value)
+			delete(given, param.Name)
+			continue
+		}
+		if err := frame.defDefault(param); err != nil {
+			return err
+		}
+	}
+
+	// keywords collected by a rest parameter don't have to be declared
+	if params.Rest == "" {
+		for name := range given {
+			return fmt.Errorf("%s: unknown keyword :%s", closure.name, name)
+		}
+	}
+
+	return nil
+}
+
+func (ctx *EvaluatorContext) defDefault(param analysis.Parameter) error {
+	if param.Default == nil {
+		ctx.def(param.Name, NIL)
+		return nil
+	}
+
+	value, err := ctx.Eval(param.Default)
+	if err != nil {
+		return err
+	}
+	ctx.def(param.Name, value)
+	return nil
+}
+
 func (ValueClosure) IsTruthy() bool {
 	return true
 }
@@ -185,12 +312,15 @@ func (ValueObject) IsCallable() bool {
 	return true
 }
 
-func (obj ValueObject) Call(arguments []Value) (Value, error) {
-	if len(arguments) != 1 {
-		panic("arity error")
+func (obj ValueObject) Call(ctx *EvaluatorContext, arguments []Value) (Value, error) {
+	if err := arity(arguments, 1); err != nil {
+		return nil, err
 	}
 
 	toFind := arguments[0]
+	if err := objectKey(toFind); err != nil {
+		return nil, err
+	}
 	value, found := obj.Entries[toFind]
 	if !found {
 		return NIL, nil
@@ -216,3 +346,82 @@ func (obj ValueObject) Compare(other Value) bool {
 
 	return true
 }
+
+type ValueSymbol struct {
+	Name string
+}
+
+func (s ValueSymbol) String() string {
+	return s.Name
+}
+
+func (ValueSymbol) IsCallable() bool {
+	return false
+}
+
+func (ValueSymbol) Call(ctx *EvaluatorContext, arguments []Value) (Value, error) {
+	panic("Symbol is not a callable value")
+}
+
+func (ValueSymbol) IsTruthy() bool {
+	return true
+}
+
+func (s ValueSymbol) Compare(other Value) bool {
+	o, ok := other.(ValueSymbol)
+	if !ok {
+		return false
+	}
+	return s.Name == o.Name
+}
+
+type ValueList struct {
+	Elements []Value
+}
+
+func (list ValueList) String() string {
+	elements := []string{}
+	for _, element := range list.Elements {
+		elements = append(elements, element.String())
+	}
+	return "(" + strings.Join(elements, " ") + ")"
+}
+
+func (ValueList) IsCallable() bool {
+	return true
+}
+
+func (list ValueList) Call(ctx *EvaluatorContext, arguments []Value) (Value, error) {
+	if err := arity(arguments, 1); err != nil {
+		return nil, err
+	}
+
+	index, err := argument[ValueNumber](arguments, 0, "number index")
+	if err != nil {
+		return nil, err
+	}
+
+	if index.Number < 0 || index.Number >= len(list.Elements) {
+		return NIL, nil
+	}
+	return list.Elements[index.Number], nil
+}
+
+func (ValueList) IsTruthy() bool {
+	return true
+}
+
+func (list ValueList) Compare(other Value) bool {
+	o, ok := other.(ValueList)
+	if !ok || len(list.Elements) != len(o.Elements) {
+		return false
+	}
+
+	for i, element := range list.Elements {
+		if !element.Compare(o.Elements[i]) {
+			return false
+		}
+	}
+
+	return true
+}
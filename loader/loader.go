@@ -0,0 +1,182 @@
+package loader
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+	"wisp/analysis"
+	"wisp/ast"
+)
+
+// Loader reads wisp files from a template root, running them through the
+// lexer, the parser and the analysis once and caching the analyzed program.
+type Loader struct {
+	root  string
+	mutex sync.Mutex
+	cache map[string]entry
+}
+
+type entry struct {
+	src     string
+	program []analysis.Form
+	// modTime is the modification time of the file when it was read.
+	modTime time.Time
+}
+
+func NewLoader(root string) *Loader {
+	return &Loader{
+		root:  root,
+		cache: map[string]entry{},
+	}
+}
+
+// Load returns the analyzed program at name, relative to the template root.
+// Names can't escape the root: "../x.wisp" resolves to "x.wisp".
+func (loader *Loader) Load(name string) ([]analysis.Form, error) {
+	entry, err := loader.load(name)
+	if err != nil {
+		return nil, err
+	}
+	return entry.program, nil
+}
+
+// Source returns the source of a file loaded before, to show where errors
+// come from.
+func (loader *Loader) Source(name string) (string, bool) {
+	loader.mutex.Lock()
+	defer loader.mutex.Unlock()
+
+	entry, found := loader.cache[loader.clean(name)]
+	return entry.src, found
+}
+
+func (loader *Loader) load(name string) (entry, error) {
+	name = loader.clean(name)
+
+	loader.mutex.Lock()
+	defer loader.mutex.Unlock()
+
+	if cached, found := loader.cache[name]; found {
+		return cached, nil
+	}
+
+	file := loader.path(name)
+	info, err := os.Stat(file)
+	if err != nil {
+		return entry{}, relative(err, name)
+	}
+	src, err := os.ReadFile(file)
+	if err != nil {
+		return entry{}, relative(err, name)
+	}
+
+	program, err := CompileFile(name, string(src))
+	if err != nil {
+		return entry{}, err
+	}
+
+	loaded := entry{src: string(src), program: program, modTime: info.ModTime()}
+	loader.cache[name] = loaded
+	return loaded, nil
+}
+
+// relative names the file of err by its path from the template root, which
+// isn't for clients to see.
+func relative(err error, name string) error {
+	var pathError *fs.PathError
+	if errors.As(err, &pathError) {
+		pathError.Path = name
+	}
+	return err
+}
+
+func (loader *Loader) clean(name string) string {
+	return path.Clean("/" + filepath.ToSlash(name))[1:]
+}
+
+func (loader *Loader) path(name string) string {
+	return filepath.Join(loader.root, filepath.FromSlash(name))
+}
+
+// Stat returns the current modification time of each file loaded, zero for
+// files removed since.
+func (loader *Loader) Stat() map[string]time.Time {
+	loader.mutex.Lock()
+	defer loader.mutex.Unlock()
+
+	times := make(map[string]time.Time, len(loader.cache))
+	for name := range loader.cache {
+		if info, err := os.Stat(loader.path(name)); err == nil {
+			times[name] = info.ModTime()
+		} else {
+			times[name] = time.Time{}
+		}
+	}
+	return times
+}
+
+// Modified reports whether a file loaded changed since it was read.
+func (loader *Loader) Modified() bool {
+	times := loader.Stat()
+
+	loader.mutex.Lock()
+	defer loader.mutex.Unlock()
+
+	for name, modTime := range times {
+		if !modTime.Equal(loader.cache[name].modTime) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reload returns a new loader from the same root with every file loaded by
+// loader read again, but those removed since. It fails, leaving loader as
+// is, if any of them does.
+func (loader *Loader) Reload() (*Loader, error) {
+	loader.mutex.Lock()
+	names := make([]string, 0, len(loader.cache))
+	for name := range loader.cache {
+		names = append(names, name)
+	}
+	loader.mutex.Unlock()
+
+	reloaded := NewLoader(loader.root)
+	for _, name := range names {
+		if _, err := reloaded.Load(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return reloaded, nil
+}
+
+// Compile lexes, parses and analyzes a script.
+func Compile(src string) ([]analysis.Form, error) {
+	return CompileFile("", src)
+}
+
+// CompileFile compiles src read from file, naming it in the spans of the
+// analyzed program.
+func CompileFile(file string, src string) ([]analysis.Form, error) {
+	lexer := ast.NewFileLexer(file, src)
+	parser := ast.NewParser(&lexer)
+	program, err := parser.Program()
+	if err != nil {
+		if file != "" {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		return nil, err
+	}
+
+	env := analysis.NewEnv()
+	forms := env.AnalyzeProgram(program)
+	if errs := env.Errors(); len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return forms, nil
+}
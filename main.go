@@ -1,94 +1,176 @@
 package main
 
 import (
-	"bufio"
+	"context"
+	"crypto/rand"
 	"errors"
+	"flag"
 	"fmt"
+	"html/template"
 	"log"
 	"net/http"
 	"os"
-	"wisp/analysis"
-	"wisp/ast"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
 	"wisp/evaluator"
+	"wisp/loader"
+	"wisp/server"
 )
 
 func main() {
-	script := `
-(defun id (x) x)
-
-(let (x 1
-      y (atoi "3"))
-  (echo "result is: " "<p>" (id (+ x y)) "</p>"))
-
-(if nil
-  (echo "hmmm")
-  (echo "nil"))
+	cfg := defaultConfig()
+	configPath := flag.String("config", "", "JSON config file, wisp.json if it exists by default")
+	cfg.flags(flag.CommandLine)
+	flag.Parse()
+
+	path, required := *configPath, true
+	if path == "" {
+		path, required = os.Getenv("WISP_CONFIG"), true
+	}
+	if path == "" {
+		path, required = "wisp.json", false
+	}
 
-(echo *newline*)
+	// the file and the environment go under the flags, parsed again on top
+	loaded := defaultConfig()
+	if err := loaded.load(path, required); err != nil {
+		log.Fatal(err)
+	}
+	if err := loaded.environ(); err != nil {
+		log.Fatal(err)
+	}
+	cfg = loaded
+	flag.Parse()
+	if err := cfg.validate(); err != nil {
+		log.Fatal(err)
+	}
 
-(def h1 {"type" "h1"})
+	command := flag.Arg(0)
+	if command == "routes" {
+		// listing routes implies declaring them
+		cfg.Routes = true
+	} else if command != "" && command != "serve" {
+		fmt.Fprintf(os.Stderr, "usage: wisp [flags] [serve|routes]\n")
+		os.Exit(2)
+	}
 
-(defun h1? (el)
-  (= (el "type") "h1"))
+	templates := loader.NewLoader(cfg.Templates)
 
-(echo (h1? h1))
+	static := server.NewStatic(cfg.Public, "/public/")
+	static.MaxAge = time.Duration(cfg.CacheMaxAge)
 
-(echo h1)
-`
+	dev := cfg.Mode == "dev"
+	options := server.Options{
+		Dev:        dev,
+		API:        cfg.API,
+		Routes:     cfg.Routes,
+		Stream:     cfg.Stream,
+		Middleware: []server.Middleware{server.Logging},
+		Limits:     evaluator.Limits{MaxBodySize: cfg.MaxBody, MaxMemory: cfg.MaxMemory},
+		Static:     static,
+	}
+	if cfg.CSRF {
+		key, err := csrfKey()
+		if err != nil {
+			log.Fatal(err)
+		}
+		options.Middleware = append(options.Middleware, server.NewCSRF(key, options.Limits).Middleware)
+	}
+	if cfg.ErrorTemplate != "" {
+		errorTemplate, err := template.ParseFiles(cfg.ErrorTemplate)
+		if err != nil {
+			log.Fatal(err)
+		}
+		options.ErrorTemplate = errorTemplate
+	}
 
-	handler, err := scriptHandler(script)
+	handler, err := server.NewHandler(templates, cfg.Script, options)
 	if err != nil {
 		log.Fatal(err)
-		os.Exit(1)
+	}
+	if command == "routes" {
+		printRoutes(handler.Routes())
+		return
 	}
 
-	mux := http.NewServeMux()
-	mux.HandleFunc("/", handler)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	err = http.ListenAndServe(":80", mux)
+	if dev {
+		go handler.Watch(ctx, 500*time.Millisecond)
+	}
 
-	if errors.Is(err, http.ErrServerClosed) {
-		fmt.Println("Server closed")
-	} else {
-		fmt.Printf("Error starting server: %s\n", err)
-		os.Exit(1)
+	mux := http.NewServeMux()
+	mux.Handle("/", handler)
+	mux.Handle(static.Prefix(), server.Logging(static))
+
+	srv := &http.Server{
+		Addr:         cfg.Address,
+		Handler:      mux,
+		ReadTimeout:  time.Duration(cfg.ReadTimeout),
+		WriteTimeout: time.Duration(cfg.WriteTimeout),
 	}
-}
+	// server-sent events last until the end of their request, so they end
+	// when shutting down instead of holding it up
+	srv.RegisterOnShutdown(handler.Shutdown)
+
+	served := make(chan error, 1)
+	go func() {
+		log.Printf("listening on %s", cfg.Address)
+		if cfg.TLSCert != "" {
+			served <- srv.ListenAndServeTLS(cfg.TLSCert, cfg.TLSKey)
+		} else {
+			served <- srv.ListenAndServe()
+		}
+	}()
 
-func scriptHandler(script string) (http.HandlerFunc, error) {
-	lexer := ast.NewLexer(script)
-	parser := ast.NewParser(&lexer)
-	program, err := parser.Program()
-	if err != nil {
-		return nil, err
+	select {
+	case err := <-served:
+		log.Fatal(err)
+	case <-ctx.Done():
 	}
+	stop()
 
-	anal := analysis.AnalyzeProgram(program)
+	log.Print("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownTimeout))
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("shutting down: %s", err)
+		os.Exit(1)
+	}
+	if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+	log.Print("server closed")
+}
 
-	fun := func(w http.ResponseWriter, r *http.Request) {
-		buf := bufio.NewWriter(w)
-		ctx := evaluator.NewContextWithWriter(buf)
-		_, err = ctx.EvalProgram(anal)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			return
+func printRoutes(routes []evaluator.Route) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "METHOD\tPATTERN\tHANDLER\tMIDDLEWARE")
+	for _, route := range routes {
+		method := route.Method
+		if method == "" {
+			method = "*"
 		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", method, route.Pattern, route.HandlerName(), strings.Join(route.MiddlewareNames(), " "))
+	}
+	tw.Flush()
+}
 
-		w.WriteHeader(http.StatusOK)
-
-		if _, err := w.Write([]byte("<html>")); err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		if err := buf.Flush(); err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		if _, err := w.Write([]byte("</html>")); err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
+// csrfKey is $WISP_CSRF_KEY, or a random key making tokens invalid after
+// restarts.
+func csrfKey() ([]byte, error) {
+	if key := os.Getenv("WISP_CSRF_KEY"); key != "" {
+		return []byte(key), nil
 	}
 
-	return fun, nil
+	log.Print("WISP_CSRF_KEY is not set, CSRF tokens won't survive restarts")
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
 }
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"wisp/evaluator"
+)
+
+// apiTypes are the media types the value of a script can be encoded as,
+// the first being the default.
+var apiTypes = []string{"application/json", "application/x-wisp", "text/plain"}
+
+// serveAPI responds with the value of the script, in the format negotiated
+// from the Accept header. The output of the script is discarded.
+func (handler *Handler) serveAPI(w http.ResponseWriter, r *http.Request, current *program, run func(*evaluator.EvaluatorContext) (evaluator.Value, error)) {
+	mediaType := negotiate(r.Header.Get("Accept"), apiTypes)
+	if mediaType == "" {
+		http.Error(w, http.StatusText(http.StatusNotAcceptable), http.StatusNotAcceptable)
+		return
+	}
+
+	response := evaluator.NewResponse()
+	ctx := current.env.NewRequestContext(io.Discard, r, response)
+	defer closeContext(ctx, r)
+	value, err := run(ctx)
+	if err != nil {
+		handler.failAPI(w, r, current, err)
+		return
+	}
+
+	var body []byte
+	if mediaType == "application/json" {
+		body, err = evaluator.EncodeJSON(value, false)
+	} else {
+		var formatted string
+		formatted, err = evaluator.Format(value)
+		body = []byte(formatted)
+	}
+	if err != nil {
+		handler.failAPI(w, r, current, err)
+		return
+	}
+
+	copyHeader(w.Header(), response.Header)
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", mediaType+"; charset=utf-8")
+	}
+	w.WriteHeader(response.Status)
+
+	if _, err := w.Write(append(body, '\n')); err != nil {
+		log.Printf("%s %s: %s", r.Method, r.URL.Path, err)
+	}
+}
+
+// apiError is the JSON body of failed API responses. Outside of
+// development, it only holds the status text.
+type apiError struct {
+	Error    string   `json:"error"`
+	Location string   `json:"location,omitempty"`
+	Stack    []string `json:"stack,omitempty"`
+}
+
+// failAPI responds to a failed evaluation with a JSON error, holding the
+// details of err in development. err is logged either way.
+func (handler *Handler) failAPI(w http.ResponseWriter, r *http.Request, current *program, err error) {
+	status := failure(r, err)
+
+	body := apiError{Error: http.StatusText(status)}
+	if handler.options.Dev {
+		page := current.devError(nil, err)
+		body.Error = page.Message
+		body.Location = page.Location
+		for _, frame := range page.Stack {
+			if frame.Location == "" {
+				body.Stack = append(body.Stack, frame.Name)
+				continue
+			}
+			body.Stack = append(body.Stack, frame.Name+" at "+frame.Location)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Print(err)
+	}
+}
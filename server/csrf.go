@@ -0,0 +1,143 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"wisp/evaluator"
+)
+
+// CSRF protects against cross-site request forgery with double-submit
+// cookies: a random secret in a cookie, and tokens signing it with a key
+// that requests other than GET, HEAD, OPTIONS and TRACE must send back in
+// a form field or a header.
+type CSRF struct {
+	key        []byte
+	CookieName string
+	FieldName  string
+	HeaderName string
+	// Limits bounds the bodies read for the token field, as those of the
+	// requests scripts read, so that the form is parsed the same way.
+	Limits evaluator.Limits
+}
+
+// NewCSRF signs tokens with key, which should be random and kept across
+// restarts for tokens to stay valid. Bodies are read within limits,
+// evaluator.DefaultLimits if zero.
+func NewCSRF(key []byte, limits evaluator.Limits) *CSRF {
+	if limits == (evaluator.Limits{}) {
+		limits = evaluator.DefaultLimits
+	}
+	return &CSRF{
+		key:        key,
+		CookieName: "wisp_csrf",
+		FieldName:  "csrf_token",
+		HeaderName: "X-CSRF-Token",
+		Limits:     limits,
+	}
+}
+
+// Token returns the token of the secret of r, setting a new secret in a
+// cookie on w if r has none. It is called once per request.
+func (csrf *CSRF) Token(w http.ResponseWriter, r *http.Request) (string, error) {
+	if secret, ok := csrf.secret(r); ok {
+		return csrf.sign(secret), nil
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrf.CookieName,
+		Value:    base64.RawURLEncoding.EncodeToString(secret),
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return csrf.sign(secret), nil
+}
+
+// Valid reports whether r sends back the token of its secret, returning
+// the error of parsing its form when the token isn't in a header.
+func (csrf *CSRF) Valid(r *http.Request) (bool, error) {
+	secret, ok := csrf.secret(r)
+	if !ok {
+		return false, nil
+	}
+
+	token := r.Header.Get(csrf.HeaderName)
+	if token == "" {
+		if err := csrf.Limits.ParseForm(r); err != nil {
+			return false, err
+		}
+		token = r.PostForm.Get(csrf.FieldName)
+	}
+	got, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return false, nil
+	}
+	return hmac.Equal(got, csrf.mac(secret)), nil
+}
+
+// Middleware rejects unsafe requests without a valid token with 403
+// Forbidden, or 413 Request Entity Too Large for bodies over the limit,
+// and gives scripts the token with (csrf-token).
+func (csrf *CSRF) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		default:
+			r.Body = http.MaxBytesReader(w, r.Body, csrf.Limits.MaxBodySize)
+			valid, err := csrf.Valid(r)
+			var tooLarge *evaluator.BodyTooLargeError
+			if errors.As(err, &tooLarge) {
+				http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+				return
+			}
+			if err != nil {
+				http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+				return
+			}
+			if !valid {
+				http.Error(w, "invalid CSRF token", http.StatusForbidden)
+				return
+			}
+		}
+
+		token, err := csrf.Token(w, r)
+		if err != nil {
+			log.Printf("%s %s: %s", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(evaluator.WithCSRFToken(r.Context(), token)))
+	})
+}
+
+func (csrf *CSRF) secret(r *http.Request) ([]byte, bool) {
+	cookie, err := r.Cookie(csrf.CookieName)
+	if err != nil {
+		return nil, false
+	}
+	secret, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil || len(secret) == 0 {
+		return nil, false
+	}
+	return secret, true
+}
+
+func (csrf *CSRF) mac(secret []byte) []byte {
+	mac := hmac.New(sha256.New, csrf.key)
+	mac.Write(secret)
+	return mac.Sum(nil)
+}
+
+func (csrf *CSRF) sign(secret []byte) string {
+	return base64.RawURLEncoding.EncodeToString(csrf.mac(secret))
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"wisp/evaluator"
+	"wisp/loader"
+)
+
+func TestCSRFWithScriptCookies(t *testing.T) {
+	root := t.TempDir()
+	script := `(set-cookie! "theme" "dark") (echo (csrf-token))`
+	if err := os.WriteFile(filepath.Join(root, "form.wisp"), []byte(script), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	csrf := NewCSRF([]byte("key"), evaluator.Limits{})
+	handler, err := NewHandler(loader.NewLoader(root), "form.wisp", Options{Middleware: []Middleware{csrf.Middleware}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := srv.Client()
+	client.Jar = jar
+
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := map[string]bool{}
+	for _, cookie := range resp.Cookies() {
+		names[cookie.Name] = true
+	}
+	if !names[csrf.CookieName] || !names["theme"] {
+		t.Fatalf("cookies = %v, want both %s and theme", resp.Cookies(), csrf.CookieName)
+	}
+
+	resp, err = client.PostForm(srv.URL, url.Values{csrf.FieldName: {string(token)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("POST with the token: status %d, want 200", resp.StatusCode)
+	}
+}
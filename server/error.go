@@ -0,0 +1,199 @@
+package server
+
+import (
+	"errors"
+	"html/template"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"wisp/ast"
+	"wisp/evaluator"
+)
+
+// ErrorData is given to Options.ErrorTemplate.
+type ErrorData struct {
+	Status     int
+	StatusText string
+}
+
+// contextLines is how many lines of source are shown around an error.
+const contextLines = 3
+
+// failure logs the failed evaluation of r, returning the status of the
+// response.
+func failure(r *http.Request, err error) int {
+	log.Printf("%s %s: %s", r.Method, r.URL.Path, err)
+
+	var tooLarge *evaluator.BodyTooLargeError
+	if errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusInternalServerError
+}
+
+// fail responds to a failed evaluation: with the details of err in
+// development, with the error template otherwise. err is logged either way.
+func (handler *Handler) fail(w http.ResponseWriter, r *http.Request, current *program, err error) {
+	status := failure(r, err)
+
+	if handler.options.Dev {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(status)
+		if err := devErrorPage.Execute(w, current.devError(r, err)); err != nil {
+			log.Print(err)
+		}
+		return
+	}
+
+	if handler.options.ErrorTemplate == nil {
+		w.WriteHeader(status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	data := ErrorData{Status: status, StatusText: http.StatusText(status)}
+	if err := handler.options.ErrorTemplate.Execute(w, data); err != nil {
+		log.Print(err)
+	}
+}
+
+type devError struct {
+	Message  string
+	Location string
+	Source   []sourceLine
+	Stack    []devFrame
+	Request  devRequest
+}
+
+type devFrame struct {
+	Name     string
+	Location string
+}
+
+type devRequest struct {
+	Method     string
+	URL        string
+	Proto      string
+	RemoteAddr string
+	Header     [][2]string
+}
+
+// sourceLine is a line of source, split around the failing span when it
+// contains it.
+type sourceLine struct {
+	Number  int
+	Failing bool
+	Before  string
+	Span    string
+	After   string
+}
+
+func (current *program) devError(r *http.Request, err error) devError {
+	page := devError{Message: err.Error()}
+
+	if r != nil {
+		page.Request = devRequest{
+			Method:     r.Method,
+			URL:        r.URL.String(),
+			Proto:      r.Proto,
+			RemoteAddr: r.RemoteAddr,
+		}
+		for _, name := range slices.Sorted(maps.Keys(r.Header)) {
+			for _, value := range r.Header[name] {
+				page.Request.Header = append(page.Request.Header, [2]string{name, value})
+			}
+		}
+	}
+
+	var located *evaluator.Error
+	if errors.As(err, &located) {
+		page.Message = located.Err.Error()
+		page.Location = current.location(located.Span)
+		if src, found := current.templates.Source(located.Span.File); found {
+			page.Source = highlight(src, located.Span)
+		}
+		for _, frame := range located.Stack {
+			page.Stack = append(page.Stack, devFrame{Name: frame.Name, Location: current.location(frame.Span)})
+		}
+	}
+
+	return page
+}
+
+// location formats span as file:line:column, and is empty for code without
+// a source.
+func (current *program) location(span ast.ByteSpan) string {
+	if span == (ast.ByteSpan{}) {
+		return ""
+	}
+	if span.File == "" {
+		span.File = "script"
+	}
+	return span.String()
+}
+
+// highlight returns the lines of src around span, splitting the first line
+// of span around it.
+func highlight(src string, span ast.ByteSpan) []sourceLine {
+	start := min(span.Start, len(src))
+	end := min(max(span.End, start), len(src))
+	line, _ := ast.LineColumn(src, start)
+
+	var lines []sourceLine
+	offset := 0
+	for i, text := range strings.SplitAfter(strings.TrimSuffix(src, "\n"), "\n") {
+		number := i + 1
+		next := offset + len(text)
+		if number >= line-contextLines && number <= line+contextLines {
+			text := strings.TrimSuffix(text, "\n")
+			if number == line {
+				from := start - offset
+				to := min(end-offset, len(text))
+				lines = append(lines, sourceLine{
+					Number:  number,
+					Failing: true,
+					Before:  text[:from],
+					Span:    text[from:max(from, to)],
+					After:   text[max(from, to):],
+				})
+			} else {
+				lines = append(lines, sourceLine{Number: number, Before: text})
+			}
+		}
+		offset = next
+	}
+	return lines
+}
+
+var devErrorPage = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>wisp: {{.Message}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+pre { background: #f6f6f6; padding: 1em; }
+.failing { background: #fde2e2; }
+mark { background: #f5a3a3; }
+td { padding: 0 1em 0 0; vertical-align: top; }
+</style>
+</head>
+<body>
+<h1>{{.Message}}</h1>
+{{with .Location}}<p>at {{.}}</p>{{end}}
+{{with .Source}}<pre>{{range .}}<span{{if .Failing}} class="failing"{{end}}>{{printf "%4d" .Number}}  {{.Before}}{{if .Span}}<mark>{{.Span}}</mark>{{end}}{{.After}}</span>
+{{end}}</pre>{{end}}
+{{with .Stack}}<h2>Stack trace</h2>
+<ol>
+{{range .}}<li>in <code>{{.Name}}</code>{{with .Location}} called at {{.}}{{end}}</li>
+{{end}}</ol>{{end}}
+<h2>Request</h2>
+<p><code>{{.Request.Method}} {{.Request.URL}} {{.Request.Proto}}</code> from {{.Request.RemoteAddr}}</p>
+<table>
+{{range .Request.Header}}<tr><td>{{index . 0}}</td><td>{{index . 1}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"mime"
+	"strconv"
+	"strings"
+)
+
+// negotiate returns the first of offers, media types such as
+// "application/json", that accept prefers, "" if it accepts none of them.
+// A missing Accept header accepts anything.
+func negotiate(accept string, offers []string) string {
+	if strings.TrimSpace(accept) == "" {
+		return offers[0]
+	}
+
+	best, bestQuality := "", 0.0
+	for _, offer := range offers {
+		if quality := acceptance(accept, offer); quality > bestQuality {
+			best, bestQuality = offer, quality
+		}
+	}
+	return best
+}
+
+// acceptance is the quality accept gives to offer, from the most specific
+// media range matching it.
+func acceptance(accept string, offer string) float64 {
+	offerType, offerSubtype, _ := strings.Cut(offer, "/")
+
+	quality, specificity := 0.0, -1
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+		if err != nil {
+			continue
+		}
+		rangeType, rangeSubtype, _ := strings.Cut(mediaType, "/")
+
+		var matched int
+		switch {
+		case rangeType == offerType && rangeSubtype == offerSubtype:
+			matched = 2
+		case rangeType == offerType && rangeSubtype == "*":
+			matched = 1
+		case rangeType == "*" && rangeSubtype == "*":
+			matched = 0
+		default:
+			continue
+		}
+		if matched <= specificity {
+			continue
+		}
+
+		specificity = matched
+		quality = 1
+		if q, found := params["q"]; found {
+			if parsed, err := strconv.ParseFloat(q, 64); err == nil {
+				quality = parsed
+			}
+		}
+	}
+	return quality
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"wisp/evaluator"
+)
+
+// route declares the routes of the script of current, serving them with a
+// ServeMux.
+func (handler *Handler) route(current *program) error {
+	routes, err := current.env.DeclareRoutes(current.forms)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	for _, route := range routes {
+		pattern := muxPattern(route)
+		h := Chain(handler.options.RouteMiddleware[pattern], handler.routeHandler(current, route))
+		if err := handle(mux, pattern, h); err != nil {
+			return err
+		}
+	}
+
+	current.routes = routes
+	current.mux = mux
+	return nil
+}
+
+// muxPattern is the ServeMux pattern of route, matching any method for
+// "*".
+func muxPattern(route evaluator.Route) string {
+	if route.Method == "" || route.Method == "*" {
+		return route.Pattern
+	}
+	return route.Method + " " + route.Pattern
+}
+
+// handle registers h, returning an error for the invalid or conflicting
+// patterns ServeMux panics on.
+func handle(mux *http.ServeMux, pattern string, h http.Handler) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("route %s: %v", pattern, r)
+		}
+	}()
+
+	mux.Handle(pattern, h)
+	return nil
+}
+
+var wildcard = regexp.MustCompile(`\{([^}.]*)(\.\.\.)?\}`)
+
+// wildcards returns the names of the wildcards of pattern, in order.
+func wildcards(pattern string) []string {
+	var names []string
+	for _, match := range wildcard.FindAllStringSubmatch(pattern, -1) {
+		if match[1] != "$" {
+			names = append(names, match[1])
+		}
+	}
+	return names
+}
+
+// routeHandler calls the handler of route, through its middleware, with
+// the values of the wildcards of its pattern.
+func (handler *Handler) routeHandler(current *program, route evaluator.Route) http.Handler {
+	names := wildcards(route.Pattern)
+	fun := route.Chain()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.serve(w, r, current, handler.options.API || route.API, func(ctx *evaluator.EvaluatorContext) (evaluator.Value, error) {
+			arguments := make([]evaluator.Value, 0, len(names))
+			for _, name := range names {
+				arguments = append(arguments, evaluator.ValueString{Contents: r.PathValue(name)})
+			}
+			return ctx.Apply(fun, arguments)
+		})
+	})
+}
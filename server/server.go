@@ -0,0 +1,200 @@
+// Package server serves wisp scripts over HTTP.
+package server
+
+import (
+	"context"
+	"html/template"
+	"log"
+	"maps"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+	"wisp/analysis"
+	"wisp/evaluator"
+	"wisp/loader"
+)
+
+// Options configures how a Handler responds.
+type Options struct {
+	// Dev shows errors in responses, with the wisp stack trace and the
+	// source around them.
+	Dev bool
+	// ErrorTemplate renders the response to errors outside of Dev, given
+	// an ErrorData. Without it, errors get an empty 500.
+	ErrorTemplate *template.Template
+	// API responds with the value of the script, encoded as JSON or as
+	// the Accept header asks, instead of its output. Errors are JSON too.
+	// With Routes, single routes can respond so with the :api option of
+	// (route method pattern handler options) instead.
+	API bool
+	// Routes evaluates the script once, when loaded, to declare routes
+	// with (route method pattern handler), instead of for each request.
+	Routes bool
+	// Middleware wraps every request, the first being the outermost. Wisp
+	// middleware, declared by the script with (use-middleware m...), only
+	// wraps routes, with Routes.
+	Middleware []Middleware
+	// RouteMiddleware wraps the routes with the given pattern, such as
+	// "GET /users/{id}", inside Middleware.
+	RouteMiddleware map[string][]Middleware
+	// Stream writes the output as it goes, instead of buffering the whole
+	// response until the script ends or calls (flush!).
+	Stream bool
+	// Limits bounds what scripts read of requests, evaluator.DefaultLimits
+	// if zero.
+	Limits evaluator.Limits
+	// Static gives scripts the URLs of static files with (asset-url name).
+	Static *Static
+}
+
+// Handler evaluates a script for each request, responding with its output.
+type Handler struct {
+	name    string
+	options Options
+	// chain is the handler wrapped in Options.Middleware.
+	chain http.Handler
+	// current is swapped as a whole when the script is reloaded, so that
+	// requests evaluate a consistent version of it.
+	current atomic.Pointer[program]
+	// done is closed by Shutdown.
+	done     chan struct{}
+	shutdown sync.Once
+}
+
+// program is a version of the script, along with the templates and
+// modules it reads.
+type program struct {
+	templates *loader.Loader
+	env       *evaluator.Environment
+	forms     []analysis.Form
+	// routes and mux are set with Options.Routes.
+	routes []evaluator.Route
+	mux    *http.ServeMux
+}
+
+// NewHandler loads the script at name from templates.
+func NewHandler(templates *loader.Loader, name string, options Options) (*Handler, error) {
+	handler := &Handler{name: name, options: options, done: make(chan struct{})}
+	handler.chain = Chain(options.Middleware, http.HandlerFunc(handler.serveHTTP))
+	if err := handler.load(templates); err != nil {
+		return nil, err
+	}
+	return handler, nil
+}
+
+func (handler *Handler) load(templates *loader.Loader) error {
+	forms, err := templates.Load(handler.name)
+	if err != nil {
+		return err
+	}
+
+	loaded := &program{
+		templates: templates,
+		env:       evaluator.NewEnvironment(templates),
+		forms:     forms,
+	}
+	if handler.options.Limits != (evaluator.Limits{}) {
+		loaded.env.SetLimits(handler.options.Limits)
+	}
+	if handler.options.Static != nil {
+		loaded.env.SetAssets(handler.options.Static)
+	}
+	if handler.options.Routes {
+		if err := handler.route(loaded); err != nil {
+			return err
+		}
+	}
+
+	handler.current.Store(loaded)
+	return nil
+}
+
+// Shutdown ends the responses lasting as long as their request, such as
+// server-sent events, for the server to shut down. Other requests are
+// still served.
+func (handler *Handler) Shutdown() {
+	handler.shutdown.Do(func() {
+		close(handler.done)
+	})
+}
+
+// Routes returns the routes declared by the script, with Options.Routes.
+func (handler *Handler) Routes() []evaluator.Route {
+	return handler.current.Load().routes
+}
+
+// Watch polls the files of the script every interval until ctx is done,
+// reloading it when they change. A version that fails to load is reported
+// and the last good one kept.
+func (handler *Handler) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// failed holds the modification times of the last version that failed
+	// to load, so that it is reported once
+	var failed map[string]time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		templates := handler.current.Load().templates
+		if !templates.Modified() {
+			continue
+		}
+		times := templates.Stat()
+		if maps.EqualFunc(times, failed, time.Time.Equal) {
+			continue
+		}
+
+		reloaded, err := templates.Reload()
+		if err == nil {
+			err = handler.load(reloaded)
+		}
+		if err != nil {
+			failed = times
+			log.Printf("reloading %s: %s; serving the last good version", handler.name, err)
+			continue
+		}
+		failed = nil
+		log.Printf("reloaded %s", handler.name)
+	}
+}
+
+func (handler *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	handler.chain.ServeHTTP(w, r)
+}
+
+func (handler *Handler) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	current := handler.current.Load()
+
+	if current.mux != nil {
+		current.mux.ServeHTTP(w, r)
+		return
+	}
+
+	handler.serve(w, r, current, handler.options.API, func(ctx *evaluator.EvaluatorContext) (evaluator.Value, error) {
+		return ctx.EvalProgram(current.forms)
+	})
+}
+
+// serve responds to r with what run evaluates, its output or, for api, its
+// value.
+func (handler *Handler) serve(w http.ResponseWriter, r *http.Request, current *program, api bool, run func(*evaluator.EvaluatorContext) (evaluator.Value, error)) {
+	if api {
+		handler.serveAPI(w, r, current, run)
+		return
+	}
+	handler.serveOutput(w, r, current, run)
+}
+
+// closeContext releases what the evaluation of r holds once handled.
+func closeContext(ctx *evaluator.EvaluatorContext, r *http.Request) {
+	if err := ctx.Close(); err != nil {
+		log.Printf("%s %s: %s", r.Method, r.URL.Path, err)
+	}
+}
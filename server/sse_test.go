@@ -0,0 +1,124 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"wisp/loader"
+)
+
+const sseScript = `
+(sse
+  (send-event "greeting" "hello
+world")
+  (send-event nil {:n 1})
+  (loop (i 0)
+    (send-event "tick" i)
+    (sleep 10)
+    (recur (inc i))))
+`
+
+func TestSSE(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "events.wisp"), []byte(sseScript), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// done is closed once the handler returns
+	done := make(chan struct{})
+	returned := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer close(done)
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	handler, err := NewHandler(loader.NewLoader(root), "events.wisp", Options{Middleware: []Middleware{returned}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", got)
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	readEvent := func() string {
+		var lines []string
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatalf("reading event: %s", err)
+			}
+			if line == "\n" {
+				return strings.Join(lines, "")
+			}
+			lines = append(lines, line)
+		}
+	}
+
+	want := []string{
+		"event: greeting\ndata: hello\ndata: world\n",
+		"data: {\"n\":1}\n",
+		"event: tick\ndata: 0\n",
+		"event: tick\ndata: 1\n",
+	}
+	for _, w := range want {
+		if got := readEvent(); got != w {
+			t.Errorf("event = %q, want %q", got, w)
+		}
+	}
+
+	// the loop runs until the client goes away
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler still running after the request was canceled")
+	}
+}
+
+func TestSendEventOutsideSSE(t *testing.T) {
+	root := t.TempDir()
+	script := `(send-event "x" "y")`
+	if err := os.WriteFile(filepath.Join(root, "index.wisp"), []byte(script), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	handler, err := NewHandler(loader.NewLoader(root), "index.wisp", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	resp, err := srv.Client().Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusInternalServerError)
+	}
+}
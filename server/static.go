@@ -0,0 +1,145 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Static serves the files of a directory under a URL prefix, with an ETag
+// from the hash of their content. URLs made by URL carry that hash, so that
+// they can be cached for good; the others are cached for MaxAge.
+type Static struct {
+	root   string
+	prefix string
+	// MaxAge is how long clients cache files requested without their
+	// fingerprint, revalidating them every time if zero.
+	MaxAge time.Duration
+
+	files  http.Handler
+	mutex  sync.Mutex
+	hashes map[string]fileHash
+}
+
+// fingerprint is how many hex digits of the hash URLs carry.
+const fingerprint = 16
+
+// fileHash is the hash of a file, valid as long as its modification time
+// and size don't change.
+type fileHash struct {
+	modTime time.Time
+	size    int64
+	hash    string
+}
+
+// NewStatic serves the files of root under prefix, such as "/public/".
+func NewStatic(root string, prefix string) *Static {
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return &Static{
+		root:   root,
+		prefix: prefix,
+		files:  http.StripPrefix(prefix, http.FileServer(http.Dir(root))),
+		hashes: map[string]fileHash{},
+	}
+}
+
+// Prefix is the path under which files are served.
+func (static *Static) Prefix() string {
+	return static.prefix
+}
+
+// URL returns the URL of the file at name, relative to the root, with the
+// hash of its content.
+func (static *Static) URL(name string) (string, error) {
+	name = path.Clean("/" + name)[1:]
+	hash, err := static.hash(name)
+	if err != nil {
+		return "", err
+	}
+	return static.prefix + name + "?v=" + hash[:fingerprint], nil
+}
+
+func (static *Static) hash(name string) (string, error) {
+	file := filepath.Join(static.root, filepath.FromSlash(name))
+	info, err := os.Stat(file)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("%s is a directory", name)
+	}
+
+	static.mutex.Lock()
+	cached, found := static.hashes[name]
+	static.mutex.Unlock()
+	if found && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+		return cached.hash, nil
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	hash := hex.EncodeToString(h.Sum(nil))
+
+	static.mutex.Lock()
+	static.hashes[name] = fileHash{modTime: info.ModTime(), size: info.Size(), hash: hash}
+	static.mutex.Unlock()
+	return hash, nil
+}
+
+func (static *Static) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name, found := strings.CutPrefix(r.URL.Path, static.prefix)
+	if !found || hidden(name) {
+		http.NotFound(w, r)
+		return
+	}
+	name = path.Clean("/" + name)[1:]
+
+	hash, err := static.hash(name)
+	if err != nil {
+		// directories aren't listed
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("ETag", `"`+hash[:32]+`"`)
+	// only the exact fingerprint of the content is cached for good, not
+	// stale or guessed ones
+	if r.URL.Query().Get("v") == hash[:fingerprint] {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else if static.MaxAge > 0 {
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(static.MaxAge.Seconds())))
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+
+	// the file server handles Last-Modified, the ETag set and ranges
+	static.files.ServeHTTP(w, r)
+}
+
+// hidden reports whether a path has dotfiles in it, which aren't served.
+func hidden(name string) bool {
+	for _, segment := range strings.Split(name, "/") {
+		if strings.HasPrefix(segment, ".") {
+			return true
+		}
+	}
+	return false
+}
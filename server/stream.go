@@ -0,0 +1,133 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"time"
+	"wisp/evaluator"
+)
+
+// outputWriter writes the output of a script to the response. It buffers
+// it, so that scripts can set the status and headers at any point and
+// errors replace what was written, until flushed. From then on, or from
+// the start with Options.Stream, it writes through.
+type outputWriter struct {
+	w          http.ResponseWriter
+	controller *http.ResponseController
+	response   *evaluator.Response
+	buffered   bool
+	buf        bytes.Buffer
+}
+
+func newOutputWriter(w http.ResponseWriter, response *evaluator.Response, buffered bool) *outputWriter {
+	output := &outputWriter{
+		w:          w,
+		controller: http.NewResponseController(w),
+		response:   response,
+		buffered:   buffered,
+	}
+	response.Flush = output.Flush
+	response.Unbounded = output.unbounded
+	return output
+}
+
+func (output *outputWriter) Write(p []byte) (int, error) {
+	if output.buffered {
+		return output.buf.Write(p)
+	}
+	output.send()
+	return output.w.Write(p)
+}
+
+// send writes the status and headers, if not yet sent. The output is HTML
+// unless the script or middleware said otherwise.
+func (output *outputWriter) send() {
+	if output.response.Sent {
+		return
+	}
+	copyHeader(output.w.Header(), output.response.Header)
+	if output.w.Header().Get("Content-Type") == "" {
+		output.w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	}
+	output.w.WriteHeader(output.response.Status)
+	output.response.Sent = true
+}
+
+// end sends what is buffered, ending the buffering.
+func (output *outputWriter) end() error {
+	output.send()
+	output.buffered = false
+	_, err := output.buf.WriteTo(output.w)
+	return err
+}
+
+// copyHeader copies the headers the script set to dst, replacing those
+// set by middleware but for cookies, which are added to theirs, such as the
+// CSRF cookie.
+func copyHeader(dst http.Header, src http.Header) {
+	for name, values := range src {
+		if name == "Set-Cookie" {
+			dst[name] = append(dst[name], values...)
+			continue
+		}
+		dst[name] = values
+	}
+}
+
+// unbounded clears the write deadline of the response, where supported.
+func (output *outputWriter) unbounded() error {
+	err := output.controller.SetWriteDeadline(time.Time{})
+	if errors.Is(err, http.ErrNotSupported) {
+		return nil
+	}
+	return err
+}
+
+// Flush sends the output written so far, the rest being written through.
+func (output *outputWriter) Flush() error {
+	if err := output.end(); err != nil {
+		return err
+	}
+	return output.controller.Flush()
+}
+
+// serveOutput responds to r with the output of run. Errors before any
+// output was sent get the error response. After, the status has been sent
+// and the error can only abort the response, so that clients see it as
+// failed rather than complete; in development, the error is written out
+// first.
+func (handler *Handler) serveOutput(w http.ResponseWriter, r *http.Request, current *program, run func(*evaluator.EvaluatorContext) (evaluator.Value, error)) {
+	response := evaluator.NewResponse()
+	response.Done = handler.done
+	output := newOutputWriter(w, response, !handler.options.Stream)
+	ctx := current.env.NewRequestContext(output, r, response)
+	defer closeContext(ctx, r)
+
+	_, err := run(ctx)
+	if err == nil {
+		if err := output.end(); err != nil {
+			log.Printf("%s %s: %s", r.Method, r.URL.Path, err)
+		}
+		return
+	}
+	if errors.Is(err, context.Canceled) && r.Context().Err() != nil {
+		// the client went away
+		return
+	}
+	if !response.Sent {
+		handler.fail(w, r, current, err)
+		return
+	}
+
+	log.Printf("%s %s: %s, after the response was sent", r.Method, r.URL.Path, err)
+	if handler.options.Dev {
+		fmt.Fprintf(w, "\n<pre class=\"wisp-error\">%s</pre>\n", html.EscapeString(err.Error()))
+		output.controller.Flush()
+	}
+	panic(http.ErrAbortHandler)
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"wisp/loader"
+)
+
+func TestContentType(t *testing.T) {
+	tests := []struct {
+		script string
+		want   string
+	}{
+		{`(echo "<p>hello</p>")`, "text/html; charset=utf-8"},
+		{`(header! "Content-Type" "text/plain") (echo "hello")`, "text/plain"},
+	}
+
+	for _, test := range tests {
+		root := t.TempDir()
+		if err := os.WriteFile(filepath.Join(root, "page.wisp"), []byte(test.script), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		handler, err := NewHandler(loader.NewLoader(root), "page.wisp", Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		if got := w.Header().Get("Content-Type"); got != test.want {
+			t.Errorf("%s: Content-Type = %q, want %q", test.script, got, test.want)
+		}
+	}
+}